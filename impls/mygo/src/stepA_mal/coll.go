@@ -0,0 +1,353 @@
+package main
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Seqable is implemented by values whose elements can be walked in order.
+// Seq returns nil if there are no elements, and otherwise a non-empty list
+// or lazy sequence of them.
+type Seqable interface {
+	MalValue
+	Seq() (MalValue, error)
+}
+
+// Counted is implemented by collections that know their number of elements
+// without walking them.
+type Counted interface {
+	MalValue
+	Count() int
+}
+
+// Indexed is implemented by collections with access by position.
+// Nth is only called with 0 <= i < Count().
+type Indexed interface {
+	Counted
+	Nth(i int) MalValue
+}
+
+// Associative is implemented by collections mapping keys to values.
+// Vectors are associative on their indices.
+type Associative interface {
+	MalValue
+	Get(key MalValue) (MalValue, bool)
+	Assoc(key MalValue, value MalValue) (MalValue, error)
+}
+
+func (l MalList) Seq() (MalValue, error) {
+	if len(l.Values) == 0 {
+		return nil, nil
+	}
+	if l.IsVector() {
+		return NewList(l.Values), nil
+	}
+	return l, nil
+}
+
+func (l MalList) Count() int {
+	return len(l.Values)
+}
+
+func (l MalList) Nth(i int) MalValue {
+	return l.Values[i]
+}
+
+// Get looks up the element at index key of a vector. Lists have no keys.
+func (l MalList) Get(key MalValue) (MalValue, bool) {
+	i, ok := key.(MalInt)
+	if !ok || !l.IsVector() || i.Value < 0 || i.Value >= int64(len(l.Values)) {
+		return nil, false
+	}
+	return l.Values[i.Value], true
+}
+
+// Assoc replaces the element at index key of a vector, or appends it if
+// key is the length of the vector.
+func (l MalList) Assoc(key MalValue, value MalValue) (MalValue, error) {
+	if !l.IsVector() {
+		return nil, NewTypeError("MalMap or MalVector", l)
+	}
+	i, ok := key.(MalInt)
+	if !ok {
+		return nil, NewTypeError("MalInt", key)
+	}
+	if i.Value < 0 || i.Value > int64(len(l.Values)) {
+		return nil, NewKindError(ErrKindIndex, fmt.Sprintf("index out of range: %d", i.Value))
+	}
+	values := make([]MalValue, len(l.Values), len(l.Values)+1)
+	copy(values, l.Values)
+	if i.Value == int64(len(values)) {
+		values = append(values, value)
+	} else {
+		values[i.Value] = value
+	}
+	vec := NewVector(values)
+	vec.Meta = l.Meta
+	return vec, nil
+}
+
+// Seq returns the characters of s as one-character strings.
+func (s MalString) Seq() (MalValue, error) {
+	if s.IsKeyword() {
+		return nil, NewTypeError("collection", s)
+	}
+	if len(s.Value) == 0 {
+		return nil, nil
+	}
+	chars := []MalValue{}
+	for _, c := range s.Value {
+		chars = append(chars, MalString{Value: string(c)})
+	}
+	return NewList(chars), nil
+}
+
+func (s MalString) Count() int {
+	return utf8.RuneCountInString(s.Value)
+}
+
+// Nth returns the i-th character of s, walking the runes before it rather
+// than decoding the whole string.
+func (s MalString) Nth(i int) MalValue {
+	for _, r := range s.Value {
+		if i == 0 {
+			return MalString{Value: string(r)}
+		}
+		i--
+	}
+	return nil
+}
+
+// Seq returns the entries of m as [key value] vectors.
+func (m *MalMap) Seq() (MalValue, error) {
+	if len(m.values) == 0 {
+		return nil, nil
+	}
+	entries := make([]MalValue, len(m.values))
+	for i, kv := range m.values {
+		entries[i] = NewVector([]MalValue{kv.Key, kv.Value})
+	}
+	return NewList(entries), nil
+}
+
+func (m *MalMap) Count() int {
+	return len(m.values)
+}
+
+func (m *MalMap) Assoc(key MalValue, value MalValue) (MalValue, error) {
+	newMap := CloneMap(m)
+	newMap.Set(key, value)
+	return newMap, nil
+}
+
+// Seq realizes the first element of s.
+func (s *MalLazySeq) Seq() (MalValue, error) {
+	if err := s.realize(); err != nil {
+		return nil, err
+	}
+	if s.empty {
+		return nil, nil
+	}
+	return s, nil
+}
+
+// isColl reports whether v is a collection. Keywords are strings in this
+// implementation, but are not collections.
+func isColl(v MalValue) bool {
+	if s, ok := v.(MalString); ok {
+		return !s.IsKeyword()
+	}
+	_, ok := v.(Seqable)
+	return ok
+}
+
+// seqOf returns the sequence of the elements of v, which is nil or a
+// collection, as Seqable.Seq does.
+func seqOf(v MalValue) (MalValue, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if !isColl(v) {
+		return nil, NewTypeError("collection", v)
+	}
+	return v.(Seqable).Seq()
+}
+
+// countOf returns the number of elements of v, walking it if it is not
+// Counted.
+func countOf(v MalValue) (int, error) {
+	if v == nil {
+		return 0, nil
+	}
+	if !isColl(v) {
+		return 0, NewTypeError("collection", v)
+	}
+	if c, ok := v.(Counted); ok {
+		return c.Count(), nil
+	}
+	n := 0
+	for {
+		if err := checkInterrupt(); err != nil {
+			return 0, err
+		}
+		_, rest, ok, err := uncons(v)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return n, nil
+		}
+		n++
+		v = rest
+	}
+}
+
+// nthOf returns the element of v at index i, walking v if it is not Indexed.
+func nthOf(v MalValue, i int64) (MalValue, error) {
+	outOfRange := NewKindError(ErrKindIndex, fmt.Sprintf("index out of range: %d", i))
+	if v != nil && !isColl(v) {
+		return nil, NewTypeError("collection", v)
+	}
+	if c, ok := v.(Indexed); ok {
+		if i < 0 || i >= int64(c.Count()) {
+			return nil, outOfRange
+		}
+		return c.Nth(int(i)), nil
+	}
+	if i < 0 {
+		return nil, outOfRange
+	}
+	values, err := seqPrefix(v, int(i)+1)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(values)) <= i {
+		return nil, outOfRange
+	}
+	return values[i], nil
+}
+
+// getOf looks up key in v, which is nil, Associative, a set or a string.
+// Other values have no keys.
+func getOf(v MalValue, key MalValue) (MalValue, bool) {
+	switch c := v.(type) {
+	case Associative:
+		return c.Get(key)
+	case *MalSet:
+		return c.Get(key)
+	case *MalSortedSet:
+		return c.Get(key)
+	case MalString:
+		i, ok := key.(MalInt)
+		if !ok || c.IsKeyword() || i.Value < 0 || i.Value >= int64(c.Count()) {
+			return nil, false
+		}
+		return c.Nth(int(i.Value)), true
+	default:
+		return nil, false
+	}
+}
+
+// assocOf returns v with key set to value. A nil v is an empty map.
+func assocOf(v MalValue, key MalValue, value MalValue) (MalValue, error) {
+	if v == nil {
+		v = NewMap()
+	}
+	c, ok := v.(Associative)
+	if !ok {
+		return nil, NewTypeError("MalMap or MalVector", v)
+	}
+	return c.Assoc(key, value)
+}
+
+// Reducible is implemented by collections that fold their elements
+// directly, without making a sequence of them. Reduce stops at the first
+// reduced value returned by f, and returns the value it holds.
+type Reducible interface {
+	MalValue
+	Reduce(f reduceFn, init MalValue) (MalValue, error)
+}
+
+type reduceFn func(acc MalValue, x MalValue) (MalValue, error)
+
+// reduceStep calls f on acc and x, and reports whether the reduction is
+// done, because f returned a reduced value or failed.
+func reduceStep(f reduceFn, acc MalValue, x MalValue) (MalValue, bool, error) {
+	if err := checkInterrupt(); err != nil {
+		return nil, true, err
+	}
+	acc, err := f(acc, x)
+	if err != nil {
+		return nil, true, err
+	}
+	if r, ok := acc.(*MalReduced); ok {
+		return r.Value, true, nil
+	}
+	return acc, false, nil
+}
+
+func (l MalList) Reduce(f reduceFn, acc MalValue) (MalValue, error) {
+	for _, x := range l.Values {
+		var done bool
+		var err error
+		if acc, done, err = reduceStep(f, acc, x); done {
+			return acc, err
+		}
+	}
+	return acc, nil
+}
+
+func (s MalString) Reduce(f reduceFn, acc MalValue) (MalValue, error) {
+	for _, c := range s.Value {
+		var done bool
+		var err error
+		if acc, done, err = reduceStep(f, acc, MalString{Value: string(c)}); done {
+			return acc, err
+		}
+	}
+	return acc, nil
+}
+
+func (m *MalMap) Reduce(f reduceFn, acc MalValue) (MalValue, error) {
+	for _, kv := range m.values {
+		var done bool
+		var err error
+		if acc, done, err = reduceStep(f, acc, NewVector([]MalValue{kv.Key, kv.Value})); done {
+			return acc, err
+		}
+	}
+	return acc, nil
+}
+
+func (s *MalLazySeq) Reduce(f reduceFn, acc MalValue) (MalValue, error) {
+	return reduceSeq(s, f, acc)
+}
+
+// reduceSeq reduces v by walking its sequence.
+func reduceSeq(v MalValue, f reduceFn, acc MalValue) (MalValue, error) {
+	for {
+		first, rest, ok, err := uncons(v)
+		if err != nil || !ok {
+			return acc, err
+		}
+		var done bool
+		if acc, done, err = reduceStep(f, acc, first); done {
+			return acc, err
+		}
+		v = rest
+	}
+}
+
+// reduceOf reduces v, which is nil or a collection, with f from init.
+func reduceOf(v MalValue, f reduceFn, init MalValue) (MalValue, error) {
+	if v == nil {
+		return init, nil
+	}
+	if !isColl(v) {
+		return nil, NewTypeError("collection", v)
+	}
+	if r, ok := v.(Reducible); ok {
+		return r.Reduce(f, init)
+	}
+	return reduceSeq(v, f, init)
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+// handlerBinding associates a condition filter with a handler.
+type handlerBinding struct {
+	filter  MalValue // keyword naming a condition kind, or a predicate
+	handler MalInvoke
+}
+
+type restart struct {
+	name   string
+	params []string
+	body   []MalValue
+	env    *Env
+}
+
+// restartInvocation unwinds the stack up to the restart-case that
+// established its restart. It is not caught by catch*.
+type restartInvocation struct {
+	restart *restart
+	args    []MalValue
+}
+
+func (r *restartInvocation) Error() string {
+	return fmt.Sprintf("restart %s invoked outside of its restart-case", r.restart.name)
+}
+
+// EvalState is the state of an interpreter shared by the threads
+// evaluating in it.
+type EvalState struct {
+	// MaxDepth limits the nesting of eval calls in a thread, which is what
+	// grows the Go stack; tail calls do not count.
+	MaxDepth int
+
+	core *Env // builtins, shared by all modules
+
+	modulesMu sync.Mutex
+	modules   map[string]*Module // by name
+
+	expansionsMu sync.Mutex
+	expansions   map[callSite]MalValue // macro expansions cached by eval
+
+	rngMu sync.Mutex
+	rng   *rand.Rand // generator of the random builtins of the math module
+}
+
+// isControlTransfer reports whether err unwinds the stack for a reason
+// other than a mal error, so that catch* must let it through.
+func isControlTransfer(err error) bool {
+	var ri *restartInvocation
+	return errors.As(err, &ri) || errors.Is(err, ErrKindInterrupted)
+}
+
+func (b handlerBinding) matches(t *Thread, cond MalValue) (bool, error) {
+	if kw, ok := b.filter.(MalString); ok {
+		if kind, err := kw.AsKeyword(); err == nil {
+			return NewErrorFromValue(cond).Is(ErrorKind(kind)), nil
+		}
+	}
+	pred, ok := b.filter.(MalInvoke)
+	if !ok {
+		return false, NewTypeError("keyword or function", b.filter)
+	}
+	matched, err := pred.Invoke(t, []MalValue{cond})
+	if err != nil {
+		return false, err
+	}
+	return isTruthy(matched), nil
+}
+
+// signal calls the handlers matching cond from the innermost outwards,
+// without unwinding the stack. A handler declines by returning normally;
+// it takes over by invoking a restart, which is returned as an error.
+func (t *Thread) signal(cond MalValue) error {
+	for i := len(t.handlers) - 1; i >= 0; i-- {
+		for _, b := range t.handlers[i] {
+			matched, err := b.matches(t, cond)
+			if err != nil {
+				return err
+			}
+			if !matched {
+				continue
+			}
+			if err := t.callHandler(i, b.handler, cond); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// callHandler runs a handler of the i-th cluster with only the outer
+// clusters active, so that signals from within the handler go outwards.
+func (t *Thread) callHandler(i int, handler MalInvoke, cond MalValue) error {
+	saved := t.handlers
+	t.handlers = saved[:i:i]
+	defer func() {
+		t.handlers = saved
+	}()
+	_, err := handler.Invoke(t, []MalValue{cond})
+	return err
+}
+
+func (t *Thread) findRestart(name string) (*restart, bool) {
+	for i := len(t.restarts) - 1; i >= 0; i-- {
+		if t.restarts[i].name == name {
+			return t.restarts[i], true
+		}
+	}
+	return nil, false
+}
+
+func evalBody(t *Thread, forms []MalValue, replEnv *Env, env *Env) (MalValue, error) {
+	var result MalValue
+	for _, form := range forms {
+		var err error
+		result, err = eval(t, form, replEnv, env)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// evalHandlerBind evaluates (handler-bind [filter handler ...] body...).
+func evalHandlerBind(t *Thread, args []MalValue, replEnv *Env, env *Env) (MalValue, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("%w for handler-bind", ErrWrongFuncNArgs)
+	}
+	bindings, ok := args[0].(MalList)
+	if !ok || len(bindings.Values)%2 != 0 {
+		return nil, syntaxError("handler-bind bindings must be an even-sized list, got %v", args[0])
+	}
+
+	cluster := []handlerBinding{}
+	for i := 0; i < len(bindings.Values); i += 2 {
+		filter, err := eval(t, bindings.Values[i], replEnv, env)
+		if err != nil {
+			return nil, err
+		}
+		h, err := eval(t, bindings.Values[i+1], replEnv, env)
+		if err != nil {
+			return nil, err
+		}
+		handler, ok := h.(MalInvoke)
+		if !ok {
+			return nil, NewTypeError("function", h)
+		}
+		cluster = append(cluster, handlerBinding{filter: filter, handler: handler})
+	}
+
+	saved := t.handlers
+	t.handlers = append(saved[:len(saved):len(saved)], cluster)
+	defer func() {
+		t.handlers = saved
+	}()
+	return evalBody(t, args[1:], replEnv, env)
+}
+
+// evalRestartCase evaluates (restart-case expr (name (params...) body...)...).
+func evalRestartCase(t *Thread, args []MalValue, replEnv *Env, env *Env) (MalValue, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("%w for restart-case", ErrWrongFuncNArgs)
+	}
+
+	restarts := []*restart{}
+	for _, arg := range args[1:] {
+		clause, ok := arg.(MalList)
+		if !ok || len(clause.Values) < 2 {
+			return nil, syntaxError("restart clause must be (name (params...) body...), got %v", arg)
+		}
+		name, ok := clause.Values[0].(MalSymbol)
+		if !ok {
+			return nil, syntaxError("restart name must be a symbol, got %v", clause.Values[0])
+		}
+		params, ok := clause.Values[1].(MalList)
+		if !ok {
+			return nil, syntaxError("restart parameters must be a list, got %v", clause.Values[1])
+		}
+		paramStrs := make([]string, len(params.Values))
+		for i, p := range params.Values {
+			sym, ok := p.(MalSymbol)
+			if !ok {
+				return nil, syntaxError("parameter must be MalSymbol, got %v", p)
+			}
+			paramStrs[i] = sym.Value
+		}
+		restarts = append(restarts, &restart{name: name.Value, params: paramStrs, body: clause.Values[2:], env: env})
+	}
+
+	result, err := func() (MalValue, error) {
+		saved := t.restarts
+		inner := saved[:len(saved):len(saved)]
+		// the first clause is the innermost restart, as found by name
+		for i := len(restarts) - 1; i >= 0; i-- {
+			inner = append(inner, restarts[i])
+		}
+		t.restarts = inner
+		defer func() {
+			t.restarts = saved
+		}()
+		return eval(t, args[0], replEnv, env)
+	}()
+	if err == nil {
+		return result, nil
+	}
+
+	var ri *restartInvocation
+	if !errors.As(err, &ri) {
+		return nil, err
+	}
+	for _, r := range restarts {
+		if r != ri.restart {
+			continue
+		}
+		restartEnv, err := NewEnv(r.env, r.params, ri.args)
+		if err != nil {
+			return nil, err
+		}
+		return evalBody(t, r.body, replEnv, restartEnv)
+	}
+	return nil, err
+}
+
+// ConditionNamespace returns the builtins of the condition system, which
+// act on the handlers and restarts of the calling thread.
+func ConditionNamespace() Namespace {
+	m := make(map[MalSymbol]MalFunc)
+
+	m[makeSymbol("signal")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		return nil, t.signal(args[0])
+	})
+	m[makeSymbol("error")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		if err := t.signal(args[0]); err != nil {
+			return nil, err
+		}
+		return nil, NewErrorFromValue(args[0])
+	})
+	m[makeSymbol("invoke-restart")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) < 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		var name string
+		switch n := args[0].(type) {
+		case MalSymbol:
+			name = n.Value
+		case MalString:
+			name = n.Value
+			if kw, err := n.AsKeyword(); err == nil {
+				name = kw
+			}
+		default:
+			return nil, NewTypeError("MalSymbol", args[0])
+		}
+		r, ok := t.findRestart(name)
+		if !ok {
+			return nil, NewKindError(ErrKindControl, fmt.Sprintf("no restart named %s is active", name))
+		}
+		return nil, &restartInvocation{restart: r, args: args[1:]}
+	})
+	m[makeSymbol("compute-restarts")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 0 {
+			return nil, ErrWrongFuncNArgs
+		}
+		names := []MalValue{}
+		for i := len(t.restarts) - 1; i >= 0; i-- {
+			names = append(names, makeSymbol(t.restarts[i].name))
+		}
+		return NewList(names), nil
+	})
+
+	return Namespace{M: m}
+}
@@ -2,16 +2,16 @@ package main
 
 import (
 	"bufio"
-	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 var (
-	ErrWrongFuncNArgs = errors.New("wrong number of arguments")
+	ErrWrongFuncNArgs = NewKindError(ErrKindArity, "wrong number of arguments")
 )
 
 type Namespace struct {
@@ -22,37 +22,114 @@ func makeSymbol(s string) MalSymbol {
 	return MalSymbol{Value: s}
 }
 
-func makeFunc(f func([]MalValue) (MalValue, error)) MalFunc {
+func makeFunc(f func(t *Thread, args []MalValue) (MalValue, error)) MalFunc {
 	return MalFunc{F: f}
 }
 
-func forceInt(a interface{}) int64 {
+func forceInt(a interface{}) (int64, error) {
 	switch a := a.(type) {
 	case int64:
-		return a
+		return a, nil
 	case float64:
-		return int64(a)
+		return int64(a), nil
 	default:
-		panic("unexpected type")
+		return 0, NewKindError(ErrKindType, fmt.Sprintf("expected a number, got %T", a))
 	}
 }
 
-func forceFloat(a interface{}) float64 {
+func forceFloat(a interface{}) (float64, error) {
 	switch a := a.(type) {
 	case int64:
-		return float64(a)
+		return float64(a), nil
 	case float64:
-		return a
+		return a, nil
 	default:
-		panic("unexpected type")
+		return 0, NewKindError(ErrKindType, fmt.Sprintf("expected a number, got %T", a))
 	}
 }
 
+// forceFloats converts the operands of a binary operation to floats.
+func forceFloats(a, b interface{}) (float64, float64, error) {
+	x, err := forceFloat(a)
+	if err != nil {
+		return 0, 0, err
+	}
+	y, err := forceFloat(b)
+	return x, y, err
+}
+
+// conjOf returns coll with xs added the way conj does.
+func conjOf(coll MalValue, xs []MalValue) (MalValue, error) {
+	if coll == nil {
+		coll = NewList([]MalValue{})
+	}
+	switch col := coll.(type) {
+	case MalList:
+		if !col.IsVector() {
+			values := make([]MalValue, 0, len(xs)+len(col.Values))
+			for i := len(xs) - 1; i >= 0; i-- {
+				values = append(values, xs[i])
+			}
+			newList := NewList(append(values, col.Values...))
+			newList.Meta = col.Meta
+			return newList, nil
+		} else {
+			newVec := col
+			values := []MalValue{}
+			values = append(values, newVec.Values...)
+			values = append(values, xs...)
+			newVec = NewVector(values)
+			newVec.Meta = col.Meta
+			return newVec, nil
+		}
+	case *MalLazySeq:
+		var seq MalValue = col
+		for _, v := range xs {
+			seq = newSeqCell(v, seq)
+		}
+		return seq, nil
+	case *MalMap:
+		newMap := CloneMap(col)
+		for _, v := range xs {
+			if err := conjEntry(newMap, v); err != nil {
+				return nil, err
+			}
+		}
+		return newMap, nil
+	case *MalSortedMap:
+		return col.Conj(xs)
+	case *MalSet:
+		return col.Conj(xs), nil
+	case *MalSortedSet:
+		return col.Conj(xs)
+	default:
+		return nil, NewTypeError("collection", coll)
+	}
+}
+
+// conjEntry adds to m a [key value] vector, or all the entries of a map.
+func conjEntry(m *MalMap, v MalValue) error {
+	switch v := v.(type) {
+	case *MalMap, *MalSortedMap:
+		entries, _ := mapEntries(v)
+		for _, kv := range entries {
+			m.Set(kv.Key, kv.Value)
+		}
+		return nil
+	case MalList:
+		if v.IsVector() && len(v.Values) == 2 {
+			m.Set(v.Values[0], v.Values[1])
+			return nil
+		}
+	}
+	return NewTypeError("map entry", v)
+}
+
 func DefaultNamespace() Namespace {
 	m := make(map[MalSymbol]MalFunc)
 	makeF :=
-		func(f func(interface{}, interface{}) interface{}) MalFunc {
-			return MalFunc{F: func(args []MalValue) (MalValue, error) {
+		func(f func(interface{}, interface{}) (interface{}, error)) MalFunc {
+			return MalFunc{F: func(t *Thread, args []MalValue) (MalValue, error) {
 				if len(args) != 2 {
 					return nil, ErrWrongFuncNArgs
 				}
@@ -61,7 +138,7 @@ func DefaultNamespace() Namespace {
 				if !aOkInt {
 					af, aOkFloat := args[0].(MalFloat)
 					if !aOkFloat {
-						return nil, fmt.Errorf("first argument is not an integer or float: %v", args[0])
+						return nil, NewTypeError("MalInt or MalFloat", args[0])
 					}
 					aVal = af.Value
 				} else {
@@ -72,14 +149,17 @@ func DefaultNamespace() Namespace {
 				if !bOkInt {
 					bf, bOkFloat := args[1].(MalFloat)
 					if !bOkFloat {
-						return nil, fmt.Errorf("second argument is not an integer or float: %v", args[1])
+						return nil, NewTypeError("MalInt or MalFloat", args[1])
 					}
 					bVal = bf.Value
 				} else {
 					bVal = b.Value
 				}
 
-				result := f(aVal, bVal)
+				result, err := f(aVal, bVal)
+				if err != nil {
+					return nil, err
+				}
 				switch v := result.(type) {
 				case int64:
 					return MalInt{Value: v}, nil
@@ -88,11 +168,47 @@ func DefaultNamespace() Namespace {
 				case bool:
 					return NewBool(v), nil
 				default:
-					panic("unexpected type")
+					return nil, NewKindError(ErrKindType, fmt.Sprintf("unexpected result type %T", result))
 				}
 			}}
 		}
-	m[makeSymbol("+")] = makeF(func(a, b interface{}) interface{} {
+	// variadic makes the binary operation op take any number of numbers,
+	// combined from the left, with (op) returning identity
+	variadic := func(op MalFunc, identity MalValue) MalFunc {
+		return makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+			switch len(args) {
+			case 0:
+				return identity, nil
+			case 2:
+				return op.F(t, args)
+			}
+			acc, err := numberArg(args[0])
+			if err != nil {
+				return nil, err
+			}
+			for _, x := range args[1:] {
+				if acc, err = op.F(t, []MalValue{acc, x}); err != nil {
+					return nil, err
+				}
+			}
+			return acc, nil
+		})
+	}
+	// inverse makes the binary operation op take one or more numbers,
+	// combined from the left, with (op x) returning (op identity x)
+	inverse := func(op MalFunc, identity MalValue) MalFunc {
+		ops := variadic(op, identity)
+		return makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+			switch len(args) {
+			case 0:
+				return nil, ErrWrongFuncNArgs
+			case 1:
+				return op.F(t, []MalValue{identity, args[0]})
+			}
+			return ops.F(t, args)
+		})
+	}
+	m[makeSymbol("+")] = variadic(makeF(func(a, b interface{}) (interface{}, error) {
 		bothInt := false
 		if _, aIsInt := a.(int64); aIsInt {
 			if _, bIsInt := b.(int64); bIsInt {
@@ -101,12 +217,13 @@ func DefaultNamespace() Namespace {
 		}
 
 		if bothInt {
-			return a.(int64) + b.(int64)
+			return a.(int64) + b.(int64), nil
 		} else {
-			return forceFloat(a) + forceFloat(b)
+			x, y, err := forceFloats(a, b)
+			return x + y, err
 		}
-	})
-	m[makeSymbol("-")] = makeF(func(a, b interface{}) interface{} {
+	}), MalInt{Value: 0})
+	m[makeSymbol("-")] = inverse(makeF(func(a, b interface{}) (interface{}, error) {
 		bothInt := false
 		if _, aIsInt := a.(int64); aIsInt {
 			if _, bIsInt := b.(int64); bIsInt {
@@ -115,12 +232,13 @@ func DefaultNamespace() Namespace {
 		}
 
 		if bothInt {
-			return a.(int64) - b.(int64)
+			return a.(int64) - b.(int64), nil
 		} else {
-			return forceFloat(a) - forceFloat(b)
+			x, y, err := forceFloats(a, b)
+			return x - y, err
 		}
-	})
-	m[makeSymbol("*")] = makeF(func(a, b interface{}) interface{} {
+	}), MalInt{Value: 0})
+	m[makeSymbol("*")] = variadic(makeF(func(a, b interface{}) (interface{}, error) {
 		bothInt := false
 		if _, aIsInt := a.(int64); aIsInt {
 			if _, bIsInt := b.(int64); bIsInt {
@@ -129,12 +247,13 @@ func DefaultNamespace() Namespace {
 		}
 
 		if bothInt {
-			return a.(int64) * b.(int64)
+			return a.(int64) * b.(int64), nil
 		} else {
-			return forceFloat(a) * forceFloat(b)
+			x, y, err := forceFloats(a, b)
+			return x * y, err
 		}
-	})
-	m[makeSymbol("/")] = makeF(func(a, b interface{}) interface{} {
+	}), MalInt{Value: 1})
+	m[makeSymbol("/")] = inverse(makeF(func(a, b interface{}) (interface{}, error) {
 		bothInt := false
 		if _, aIsInt := a.(int64); aIsInt {
 			if _, bIsInt := b.(int64); bIsInt {
@@ -143,103 +262,93 @@ func DefaultNamespace() Namespace {
 		}
 
 		if bothInt {
-			return a.(int64) / b.(int64)
+			if b.(int64) == 0 {
+				return nil, errDivideByZero
+			}
+			return a.(int64) / b.(int64), nil
 		} else {
-			return forceFloat(a) / forceFloat(b)
-		}
-	})
-	m[makeSymbol("prnn")] = makeFunc(func(args []MalValue) (MalValue, error) {
-		if len(args) != 1 {
-			return nil, ErrWrongFuncNArgs
+			x, y, err := forceFloats(a, b)
+			return x / y, err
 		}
-		s := PrStr(args[0], true)
-		fmt.Print(s)
-		return nil, nil
-	})
-	m[makeSymbol("prn")] = makeFunc(func(args []MalValue) (MalValue, error) {
-		if len(args) != 1 {
-			return nil, ErrWrongFuncNArgs
-		}
-		s := PrStr(args[0], true)
-		fmt.Println(s)
-		return nil, nil
-	})
-	m[makeSymbol("list")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	}), MalInt{Value: 1})
+	m[makeSymbol("list")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		values := make([]MalValue, len(args))
 		copy(values, args)
 		return MalList{Values: values}, nil
 	})
-	m[makeSymbol("list?")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("list?")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 1 {
 			return nil, ErrWrongFuncNArgs
 		}
 		lst, ok := args[0].(MalList)
 		return MalBool{Value: ok && !lst.IsVector()}, nil
 	})
-	m[makeSymbol("empty?")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("empty?")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 1 {
 			return nil, ErrWrongFuncNArgs
 		}
-		if args[0] == nil {
-			return MalBool{Value: true}, nil
-		}
-		_, ok := args[0].(MalList)
-		if !ok {
-			return nil, fmt.Errorf("expected MalList, got %v", args[0])
+		seq, err := seqOf(args[0])
+		if err != nil {
+			return nil, err
 		}
-		return MalBool{Value: len(args[0].(MalList).Values) == 0}, nil
+		return MalBool{Value: seq == nil}, nil
 	})
-	m[makeSymbol("count")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("count")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 1 {
 			return nil, ErrWrongFuncNArgs
 		}
-		if args[0] == nil {
-			return MalInt{Value: 0}, nil
-		}
-		l, ok := args[0].(MalList)
-		if !ok {
-			return nil, fmt.Errorf("expected MalList, got %v", args[0])
+		n, err := countOf(args[0])
+		if err != nil {
+			return nil, err
 		}
-		return MalInt{Value: int64(len(l.Values))}, nil
+		return MalInt{Value: int64(n)}, nil
 	})
-	m[makeSymbol("=")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("=")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 2 {
 			return nil, ErrWrongFuncNArgs
 		}
-		return MalBool{Value: malEq(args[0], args[1])}, nil
+		eq, err := malEqual(args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+		return MalBool{Value: eq}, nil
 	})
 
-	m[makeSymbol("<")] = makeF(func(a, b interface{}) interface{} {
-		return forceFloat(a) < forceFloat(b)
+	m[makeSymbol("<")] = makeF(func(a, b interface{}) (interface{}, error) {
+		x, y, err := forceFloats(a, b)
+		return x < y, err
 	})
-	m[makeSymbol("<=")] = makeF(func(a, b interface{}) interface{} {
-		return forceFloat(a) <= forceFloat(b)
+	m[makeSymbol("<=")] = makeF(func(a, b interface{}) (interface{}, error) {
+		x, y, err := forceFloats(a, b)
+		return x <= y, err
 	})
-	m[makeSymbol(">")] = makeF(func(a, b interface{}) interface{} {
-		return forceFloat(a) > forceFloat(b)
+	m[makeSymbol(">")] = makeF(func(a, b interface{}) (interface{}, error) {
+		x, y, err := forceFloats(a, b)
+		return x > y, err
 	})
-	m[makeSymbol(">=")] = makeF(func(a, b interface{}) interface{} {
-		return forceFloat(a) >= forceFloat(b)
+	m[makeSymbol(">=")] = makeF(func(a, b interface{}) (interface{}, error) {
+		x, y, err := forceFloats(a, b)
+		return x >= y, err
 	})
 
-	m[makeSymbol("read-string")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("read-string")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 1 {
 			return nil, ErrWrongFuncNArgs
 		}
 		s, ok := args[0].(MalString)
 		if !ok {
-			return nil, fmt.Errorf("expected MalString, got %v", args[0])
+			return nil, NewTypeError("MalString", args[0])
 		}
-		return ReadStr(s.Value)
+		return readFirst(t.codeReader(s.Value))
 	})
 
-	m[makeSymbol("slurp")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("slurp")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 1 {
 			return nil, ErrWrongFuncNArgs
 		}
 		s, ok := args[0].(MalString)
 		if !ok {
-			return nil, fmt.Errorf("expected MalString, got %v", args[0])
+			return nil, NewTypeError("MalString", args[0])
 		}
 
 		// open file with filename s
@@ -256,108 +365,68 @@ func DefaultNamespace() Namespace {
 		return MalString{Value: string(content)}, nil
 	})
 
-	m[makeSymbol("pr-str")] = makeFunc(func(args []MalValue) (MalValue, error) {
-		strs := make([]string, len(args))
-		for i, a := range args {
-			strs[i] = PrStr(a, true)
-		}
-		str := strings.Join(strs, " ")
-		return MalString{Value: str}, nil
-	})
-	m[makeSymbol("str")] = makeFunc(func(args []MalValue) (MalValue, error) {
-		strs := make([]string, len(args))
-		for i, a := range args {
-			strs[i] = PrStr(a, false)
-		}
-		str := strings.Join(strs, "")
-		return MalString{Value: str}, nil
-	})
-	m[makeSymbol("prn")] = makeFunc(func(args []MalValue) (MalValue, error) {
-		for i, arg := range args {
-			s := PrStr(arg, true)
-
-			if i > 0 {
-				fmt.Print(" ")
-			}
-			fmt.Print(s)
-		}
-		fmt.Println()
-		return nil, nil
-	})
-	m[makeSymbol("print")] = makeFunc(func(args []MalValue) (MalValue, error) {
-		for i, arg := range args {
-			s := PrStr(arg, false)
-
-			if i > 0 {
-				fmt.Print(" ")
-			}
-			fmt.Print(s)
-		}
-		return nil, nil
-	})
-	m[makeSymbol("println")] = makeFunc(func(args []MalValue) (MalValue, error) {
-		for i, arg := range args {
-			s := PrStr(arg, false)
-
-			if i > 0 {
-				fmt.Print(" ")
+	m[makeSymbol("atom")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		switch len(args) {
+		case 1:
+			return NewMalAtom(args[0]), nil
+		case 3:
+			if !malEq(args[1], NewKeyword("meta")) {
+				return nil, fmt.Errorf("%w: expected :meta option, got %s", ErrWrongFuncNArgs, PrStr(args[1], true))
 			}
-			fmt.Print(s)
-		}
-		fmt.Println()
-		return nil, nil
-	})
-
-	m[makeSymbol("atom")] = makeFunc(func(args []MalValue) (MalValue, error) {
-		if len(args) != 1 {
+			a := NewMalAtom(args[0])
+			a.Meta = args[2]
+			return a, nil
+		default:
 			return nil, ErrWrongFuncNArgs
 		}
-		return NewMalAtom(args[0]), nil
 	})
-	m[makeSymbol("atom?")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("atom?")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 1 {
 			return nil, ErrWrongFuncNArgs
 		}
 		_, ok := args[0].(*MalAtom)
 		return MalBool{Value: ok}, nil
 	})
-	m[makeSymbol("deref")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("deref")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 1 {
 			return nil, ErrWrongFuncNArgs
 		}
-		a, ok := args[0].(*MalAtom)
-		if !ok {
-			return nil, fmt.Errorf("expected MalAtom, got %v", args[0])
+		switch a := args[0].(type) {
+		case *MalAtom:
+			return a.Ref, nil
+		case *MalReduced:
+			return a.Value, nil
+		default:
+			return nil, NewTypeError("MalAtom", args[0])
 		}
-		return a.Ref, nil
 	})
-	m[makeSymbol("reset!")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("reset!")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 2 {
 			return nil, ErrWrongFuncNArgs
 		}
 		a, ok := args[0].(*MalAtom)
 		if !ok {
-			return nil, fmt.Errorf("expected MalAtom, got %v", args[0])
+			return nil, NewTypeError("MalAtom", args[0])
 		}
 		a.Ref = args[1]
 		return args[1], nil
 	})
-	m[makeSymbol("swap!")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("swap!")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) < 2 {
 			return nil, ErrWrongFuncNArgs
 		}
 		a, ok := args[0].(*MalAtom)
 		if !ok {
-			return nil, fmt.Errorf("expected MalAtom, got %v", args[0])
+			return nil, NewTypeError("MalAtom", args[0])
 		}
 		f, ok := args[1].(MalInvoke)
 		if !ok {
-			return nil, fmt.Errorf("expected MalFunc, got %v", args[1])
+			return nil, NewTypeError("MalFunc", args[1])
 		}
 		fArgs := make([]MalValue, len(args)-1)
 		fArgs[0] = a.Ref
 		copy(fArgs[1:], args[2:])
-		newVal, err := f.Invoke(fArgs)
+		newVal, err := f.Invoke(t, fArgs)
 		if err != nil {
 			return nil, err
 		}
@@ -365,152 +434,148 @@ func DefaultNamespace() Namespace {
 		return newVal, nil
 	})
 
-	m[makeSymbol("cons")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("cons")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 2 {
 			return nil, ErrWrongFuncNArgs
 		}
-		l, ok := args[1].(MalList)
-		if !ok {
-			return nil, fmt.Errorf("expected MalList, got %v", args[1])
+		if s, ok := args[1].(*MalLazySeq); ok {
+			// the rest is left unrealized
+			return newSeqCell(args[0], s), nil
 		}
-		values := make([]MalValue, len(l.Values)+1)
+		rest, err := seqValues(args[1])
+		if err != nil {
+			return nil, err
+		}
+		values := make([]MalValue, len(rest)+1)
 		values[0] = args[0]
-		copy(values[1:], l.Values)
+		copy(values[1:], rest)
 		return MalList{Values: values}, nil
 	})
-	m[makeSymbol("concat")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("concat")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		values := make([]MalValue, 0)
-		for _, a := range args {
-			l, ok := a.(MalList)
-			if !ok {
-				return nil, fmt.Errorf("expected MalList, got %v", a)
+		for i, a := range args {
+			if s, ok := a.(*MalLazySeq); ok {
+				// keep the lazy sequences lazy, as they may be infinite
+				return concatSeq(NewList(values), s, args[i+1:]), nil
 			}
-			values = append(values, l.Values...)
+			elems, err := seqValues(a)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, elems...)
 		}
 		return MalList{Values: values}, nil
 	})
-	m[makeSymbol("nth")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("nth")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 2 {
 			return nil, ErrWrongFuncNArgs
 		}
-		l, ok := args[0].(MalList)
-		if !ok {
-			return nil, fmt.Errorf("expected MalList, got %v", args[0])
-		}
 		i, ok := args[1].(MalInt)
 		if !ok {
-			return nil, fmt.Errorf("expected MalInt, got %v", args[1])
+			return nil, NewTypeError("MalInt", args[1])
 		}
-		if i.Value < 0 || i.Value >= int64(len(l.Values)) {
-			return nil, fmt.Errorf("index out of range: %d", i.Value)
-		}
-		return l.Values[i.Value], nil
+		return nthOf(args[0], i.Value)
 	})
-	m[makeSymbol("first")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("first")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 1 {
 			return nil, ErrWrongFuncNArgs
 		}
-		if args[0] == nil {
-			return nil, nil
-		}
-		l, ok := args[0].(MalList)
-		if !ok {
-			return nil, fmt.Errorf("expected MalList, got %v", args[0])
-		}
-		if len(l.Values) == 0 {
-			return nil, nil
-		}
-		return l.Values[0], nil
+		first, _, _, err := uncons(args[0])
+		return first, err
 	})
-	m[makeSymbol("rest")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("rest")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 1 {
 			return nil, ErrWrongFuncNArgs
 		}
-		if args[0] == nil {
-			return NewList([]MalValue{}), nil
-		}
-		l, ok := args[0].(MalList)
-		if !ok {
-			return nil, fmt.Errorf("expected MalList, got %v", args[0])
+		_, rest, ok, err := uncons(args[0])
+		if err != nil {
+			return nil, err
 		}
-		if len(l.Values) == 0 {
-			return MalList{Values: []MalValue{}}, nil
+		if !ok || rest == nil {
+			return NewList([]MalValue{}), nil
 		}
-		return MalList{Values: l.Values[1:]}, nil
+		return rest, nil
 	})
 
-	m[makeSymbol("throw")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("throw")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 1 {
 			return nil, ErrWrongFuncNArgs
 		}
 		return nil, NewErrorFromValue(args[0])
 	})
 
-	m[makeSymbol("apply")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("ex-info")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 2 && len(args) != 3 {
+			return nil, ErrWrongFuncNArgs
+		}
+		msg, ok := args[0].(MalString)
+		if !ok || msg.IsKeyword() {
+			return nil, NewTypeError("MalString", args[0])
+		}
+		if _, ok := args[1].(*MalMap); !ok && args[1] != nil {
+			return nil, NewTypeError("MalMap", args[1])
+		}
+		var cause error
+		if len(args) == 3 && args[2] != nil {
+			cause = NewErrorFromValue(args[2])
+		}
+		return NewExInfo(msg.Value, args[1], cause), nil
+	})
+
+	m[makeSymbol("apply")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) < 2 {
 			return nil, ErrWrongFuncNArgs
 		}
 		f, ok := args[0].(MalInvoke)
 		if !ok {
-			return nil, fmt.Errorf("expected MalFunc, got %v", args[0])
+			return nil, NewTypeError("MalFunc", args[0])
 		}
 
-		lastList, ok := args[len(args)-1].(MalList)
-		if !ok {
-			return nil, fmt.Errorf("expected MalList or MalVector, got %v", args[len(args)-1])
+		last, err := seqValues(args[len(args)-1])
+		if err != nil {
+			return nil, err
 		}
 
 		fArgs := make([]MalValue, 0)
 		for i := 1; i < len(args)-1; i++ {
 			fArgs = append(fArgs, args[i])
 		}
-		fArgs = append(fArgs, lastList.Values...)
-		return f.Invoke(fArgs)
+		fArgs = append(fArgs, last...)
+		return f.Invoke(t, fArgs)
 	})
 
-	m[makeSymbol("map")] = makeFunc(func(args []MalValue) (MalValue, error) {
-		if len(args) != 2 {
+	m[makeSymbol("map")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) < 1 {
 			return nil, ErrWrongFuncNArgs
 		}
 		f, ok := args[0].(MalInvoke)
 		if !ok {
-			return nil, fmt.Errorf("expected MalFunc, got %v", args[0])
+			return nil, NewTypeError("MalFunc", args[0])
 		}
-
-		l, ok := args[1].(MalList)
-		if !ok {
-			return nil, fmt.Errorf("expected MalList or MalVector, got %v", args[1])
-		}
-
-		values := make([]MalValue, len(l.Values))
-		for i, v := range l.Values {
-			result, err := f.Invoke([]MalValue{v})
-			if err != nil {
-				return nil, err
-			}
-			values[i] = result
+		if len(args) == 1 {
+			return mapXf(f), nil
 		}
-		return MalList{Values: values}, nil
+		return lazyIf(mapSeq(t, f, args[1:]), args[1:]...)
 	})
 
-	m[makeSymbol("symbol")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("symbol")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 1 {
 			return nil, ErrWrongFuncNArgs
 		}
 		s, ok := args[0].(MalString)
 		if !ok {
-			return nil, fmt.Errorf("expected MalString, got %v", args[0])
+			return nil, NewTypeError("MalString", args[0])
 		}
 		return makeSymbol(s.Value), nil
 	})
 
-	m[makeSymbol("keyword")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("keyword")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 1 {
 			return nil, ErrWrongFuncNArgs
 		}
 		s, ok := args[0].(MalString)
 		if !ok {
-			return nil, fmt.Errorf("expected MalString, got %v", args[0])
+			return nil, NewTypeError("MalString", args[0])
 		}
 		if s.IsKeyword() {
 			return s, nil
@@ -518,60 +583,62 @@ func DefaultNamespace() Namespace {
 		return NewKeyword(s.Value), nil
 	})
 
-	m[makeSymbol("vector")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("vector")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		values := make([]MalValue, len(args))
 		copy(values, args)
 		return NewVector(values), nil
 	})
 
-	m[makeSymbol("vec")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("vec")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 1 {
 			return nil, ErrWrongFuncNArgs
 		}
-
-		switch v := args[0].(type) {
-		case MalList:
-			if v.IsVector() {
-				return v, nil
-			}
-			return NewVector(v.Values), nil
-		default:
-			return nil, fmt.Errorf("expected MalList, got %v", args[0])
+		if v, ok := args[0].(MalList); ok && v.IsVector() {
+			return v, nil
 		}
+		values, err := seqValues(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return NewVector(values), nil
 	})
 
-	m[makeSymbol("hash-map")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("hash-map")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args)%2 != 0 {
-			return nil, fmt.Errorf("expected even number of arguments, got %d", len(args))
+			return nil, fmt.Errorf("%w: expected even number of arguments, got %d", ErrWrongFuncNArgs, len(args))
 		}
 		return NewMapFromList(args)
 	})
 
-	m[makeSymbol("assoc")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("assoc")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) < 3 {
-			return nil, fmt.Errorf("expected at least 3 arguments, got %d", len(args))
-		}
-		m, ok := args[0].(*MalMap)
-		if !ok {
-			return nil, fmt.Errorf("expected MalMap, got %v", args[0])
+			return nil, fmt.Errorf("%w: expected at least 3 arguments, got %d", ErrWrongFuncNArgs, len(args))
 		}
 		if len(args)%2 != 1 {
-			return nil, fmt.Errorf("expected even number of arguments, got %d", len(args))
+			return nil, fmt.Errorf("%w: expected even number of arguments, got %d", ErrWrongFuncNArgs, len(args))
 		}
-		newMap := CloneMap(m)
+		// (assoc nil k v) makes a map, as in (vary-meta x assoc k v)
+		result := args[0]
 		for i := 1; i < len(args); i += 2 {
-			newMap.Set(args[i], args[i+1])
+			var err error
+			result, err = assocOf(result, args[i], args[i+1])
+			if err != nil {
+				return nil, err
+			}
 		}
-		return newMap, nil
+		return result, nil
 	})
 
-	m[makeSymbol("dissoc")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("dissoc")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) < 2 {
 			return nil, ErrWrongFuncNArgs
 		}
+		if sm, ok := args[0].(*MalSortedMap); ok {
+			return sm.Dissoc(args[1:])
+		}
 		m, ok := args[0].(*MalMap)
 		if !ok {
-			return nil, fmt.Errorf("expected MalMap, got %v", args[0])
+			return nil, NewTypeError("MalMap", args[0])
 		}
 
 		newMap := CloneMap(m)
@@ -581,75 +648,64 @@ func DefaultNamespace() Namespace {
 		return newMap, nil
 	})
 
-	m[makeSymbol("get")] = makeFunc(func(args []MalValue) (MalValue, error) {
-		if len(args) != 2 {
+	m[makeSymbol("get")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 2 && len(args) != 3 {
 			return nil, ErrWrongFuncNArgs
 		}
-		if args[0] == nil {
-			return nil, nil
-		}
-		m, ok := args[0].(*MalMap)
-		if !ok {
-			return nil, fmt.Errorf("expected MalMap, got %v", args[0])
-		}
-		v, ok := m.Get(args[1])
-		if !ok {
-			return nil, nil
+		v, ok := getOf(args[0], args[1])
+		if !ok && len(args) == 3 {
+			return args[2], nil
 		}
 		return v, nil
 	})
 
-	m[makeSymbol("contains?")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("contains?")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 2 {
 			return nil, ErrWrongFuncNArgs
 		}
-		m, ok := args[0].(*MalMap)
-		if !ok {
-			return nil, fmt.Errorf("expected MalMap, got %v", args[0])
-		}
-		_, ok = m.Get(args[1])
+		_, ok := getOf(args[0], args[1])
 		return NewBool(ok), nil
 	})
 
-	m[makeSymbol("keys")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("keys")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 1 {
 			return nil, ErrWrongFuncNArgs
 		}
-		m, ok := args[0].(*MalMap)
+		entries, ok := mapEntries(args[0])
 		if !ok {
-			return nil, fmt.Errorf("expected MalMap, got %v", args[0])
+			return nil, NewTypeError("MalMap", args[0])
 		}
 
 		keys := make([]MalValue, 0)
-		for _, kv := range m.Iter() {
+		for _, kv := range entries {
 			keys = append(keys, kv.Key)
 		}
 		return NewList(keys), nil
 	})
 
-	m[makeSymbol("vals")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("vals")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 1 {
 			return nil, ErrWrongFuncNArgs
 		}
-		m, ok := args[0].(*MalMap)
+		entries, ok := mapEntries(args[0])
 		if !ok {
-			return nil, fmt.Errorf("expected MalMap, got %v", args[0])
+			return nil, NewTypeError("MalMap", args[0])
 		}
 
 		vals := make([]MalValue, 0)
-		for _, kv := range m.Iter() {
+		for _, kv := range entries {
 			vals = append(vals, kv.Value)
 		}
 		return NewList(vals), nil
 	})
 
-	m[makeSymbol("readline")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("readline")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 1 {
 			return nil, ErrWrongFuncNArgs
 		}
 		prompt, ok := args[0].(MalString)
 		if !ok {
-			return nil, fmt.Errorf("expected MalString, got %v", args[0])
+			return nil, NewTypeError("MalString", args[0])
 		}
 
 		fmt.Print(prompt)
@@ -661,127 +717,101 @@ func DefaultNamespace() Namespace {
 		return MalString{Value: scanner.Text()}, nil
 	})
 
-	m[makeSymbol("time-ms")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("time-ms")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		// get unixtime
 		unix := time.Now().UnixMilli()
 		return MalInt{Value: unix}, nil
 	})
-	m[makeSymbol("meta")] = makeFunc(func(args []MalValue) (MalValue, error) {
-		return MalInt{Value: 0}, nil
+	m[makeSymbol("seq")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		return seqOf(args[0])
 	})
-	m[makeSymbol("with-meta")] = makeFunc(func(args []MalValue) (MalValue, error) {
-		return MalInt{Value: 0}, nil
+	m[makeSymbol("conj")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		// (conj) and (conj coll) make conj a reducing function
+		switch len(args) {
+		case 0:
+			return NewVector([]MalValue{}), nil
+		case 1:
+			return args[0], nil
+		}
+		return conjOf(args[0], args[1:])
 	})
-	m[makeSymbol("seq")] = makeFunc(func(args []MalValue) (MalValue, error) {
+
+	m[makeSymbol("meta")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 1 {
 			return nil, ErrWrongFuncNArgs
 		}
 
-		if args[0] == nil {
+		v, ok := args[0].(MalMeta)
+		if !ok {
 			return nil, nil
 		}
+		return v.GetMeta(), nil
+	})
 
-		switch v := args[0].(type) {
-		case MalList:
-			if len(v.Values) == 0 {
-				return nil, nil
-			}
-			if v.IsVector() {
-				return NewList(v.Values), nil
-			}
-			return v, nil
-		case MalString:
-			if len(v.Value) == 0 {
-				return nil, nil
-			}
-			chars := []MalValue{}
-			for _, c := range v.Value {
-				chars = append(chars, MalString{Value: string(c)})
-			}
-			return NewList(chars), nil
-		default:
-			return nil, fmt.Errorf("expected MalList or MalString, got %v", args[0])
+	m[makeSymbol("with-meta")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 2 {
+			return nil, ErrWrongFuncNArgs
 		}
+		v, ok := args[0].(MalWithMeta)
+		if !ok {
+			return nil, NewTypeError("MalList, MalMap, MalSymbol, MalFunc, or MalTcoFunc", args[0])
+		}
+		return v.WithMeta(args[1]), nil
 	})
-	m[makeSymbol("conj")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("vary-meta")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) < 2 {
-			return nil, fmt.Errorf("expected at least 2 arguments, got %d", len(args))
-		}
-		switch col := args[0].(type) {
-		case MalList:
-			if !col.IsVector() {
-				newList := col
-				for _, v := range args[1:] {
-					values := []MalValue{v}
-					values = append(values, newList.Values...)
-					newList = NewList(values)
-				}
-				return newList, nil
-			} else {
-				newVec := col
-				values := []MalValue{}
-				values = append(values, newVec.Values...)
-				values = append(values, args[1:]...)
-				newVec = NewVector(values)
-				return newVec, nil
-			}
-		default:
-			return nil, fmt.Errorf("expected MalList or MalVector, got %v", args[0])
+			return nil, ErrWrongFuncNArgs
+		}
+		v, ok := args[0].(MalWithMeta)
+		if !ok {
+			return nil, NewTypeError("MalList, MalMap, MalSymbol, MalFunc, or MalTcoFunc", args[0])
+		}
+		f, ok := args[1].(MalInvoke)
+		if !ok {
+			return nil, NewTypeError("MalFunc", args[1])
 		}
+		meta, err := f.Invoke(t, append([]MalValue{v.GetMeta()}, args[2:]...))
+		if err != nil {
+			return nil, err
+		}
+		return v.WithMeta(meta), nil
 	})
-
-	m[makeSymbol("meta")] = makeFunc(func(args []MalValue) (MalValue, error) {
-		if len(args) != 1 {
+	m[makeSymbol("alter-meta!")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) < 2 {
 			return nil, ErrWrongFuncNArgs
 		}
-
-		switch v := args[0].(type) {
-		case MalList:
-			return v.Meta, nil
-		case *MalMap:
-			return v.GetMeta(), nil
-		case MalFunc:
-			return v.Meta, nil
-		case MalTcoFunc:
-			return v.Fn.Meta, nil
-		default:
-			return nil, fmt.Errorf("expected MalList, MalMap, MalFunc, or MalTcoFunc, got %v", args[0])
+		a, ok := args[0].(*MalAtom)
+		if !ok {
+			return nil, NewTypeError("MalAtom", args[0])
+		}
+		f, ok := args[1].(MalInvoke)
+		if !ok {
+			return nil, NewTypeError("MalFunc", args[1])
+		}
+		meta, err := f.Invoke(t, append([]MalValue{a.Meta}, args[2:]...))
+		if err != nil {
+			return nil, err
 		}
+		a.Meta = meta
+		return meta, nil
 	})
-
-	m[makeSymbol("with-meta")] = makeFunc(func(args []MalValue) (MalValue, error) {
+	m[makeSymbol("reset-meta!")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 		if len(args) != 2 {
 			return nil, ErrWrongFuncNArgs
 		}
-		meta := args[1]
-
-		switch v := args[0].(type) {
-		case MalList:
-			copied := MalList{Values: v.Values, Vector: v.Vector}
-			copied.Meta = meta
-			return copied, nil
-		case *MalMap:
-			copied := CloneMap(v)
-			copied.SetMeta(meta)
-			return copied, nil
-		case MalFunc:
-			copied := MalFunc{F: v.F, Macro: v.Macro, Meta: meta}
-			return copied, nil
-		case MalTcoFunc:
-			fnCopied := MalFunc{
-				F: v.Fn.F, Macro: v.Fn.Macro, Meta: meta,
-			}
-			copied := MalTcoFunc{
-				Ast: v.Ast, Params: v.Params, Env: v.Env, Fn: fnCopied,
-			}
-			return copied, nil
-		default:
-			return nil, fmt.Errorf("expected MalList, MalMap, MalFunc, or MalTcoFunc, got %v", args[0])
+		a, ok := args[0].(*MalAtom)
+		if !ok {
+			return nil, NewTypeError("MalAtom", args[0])
 		}
+		a.Meta = args[1]
+		return args[1], nil
 	})
 
 	onePred := func(f func(MalValue) bool) MalFunc {
-		return makeFunc(func(args []MalValue) (MalValue, error) {
+		return makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
 			if len(args) != 1 {
 				return nil, ErrWrongFuncNArgs
 			}
@@ -811,14 +841,8 @@ func DefaultNamespace() Namespace {
 		l, ok := v.(MalList)
 		return ok && l.IsVector()
 	})
-	m[makeSymbol("sequential?")] = onePred(func(v MalValue) bool {
-		_, ok := v.(MalList)
-		return ok
-	})
-	m[makeSymbol("map?")] = onePred(func(v MalValue) bool {
-		_, ok := v.(*MalMap)
-		return ok
-	})
+	m[makeSymbol("sequential?")] = onePred(isSeq)
+	m[makeSymbol("map?")] = onePred(isMap)
 	m[makeSymbol("fn?")] = onePred(func(v MalValue) bool {
 		f, ok := v.(MalInvoke)
 		return ok && !f.IsMacro()
@@ -831,6 +855,20 @@ func DefaultNamespace() Namespace {
 		_, ok := v.(MalInt)
 		return ok
 	})
+	m[makeSymbol("gensym")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		switch len(args) {
+		case 0:
+			return gensym("G__"), nil
+		case 1:
+			prefix, ok := args[0].(MalString)
+			if !ok || prefix.IsKeyword() {
+				return nil, NewTypeError("MalString", args[0])
+			}
+			return gensym(prefix.Value), nil
+		default:
+			return nil, ErrWrongFuncNArgs
+		}
+	})
 	m[makeSymbol("macro?")] = onePred(func(v MalValue) bool {
 		f, ok := v.(MalInvoke)
 		return ok && f.IsMacro()
@@ -839,35 +877,105 @@ func DefaultNamespace() Namespace {
 	return Namespace{M: m}
 }
 
-func quasiquote(ast MalValue, ignoreUnquote bool) (MalValue, error) {
-	switch q := ast.(type) {
+// gensymCounter numbers the symbols made by gensym and auto-gensym.
+var gensymCounter atomic.Int64
+
+func gensym(prefix string) MalSymbol {
+	return makeSymbol(fmt.Sprintf("%s%d", prefix, gensymCounter.Add(1)))
+}
+
+// specialForms are never qualified by syntax-quote.
+var specialForms = map[string]bool{
+	"def!": true, "defmacro!": true, "let*": true, "do": true, "if": true,
+	"fn*": true, "quote": true, "var": true, "quasiquote": true, "quasiquoteexpand": true,
+	"unquote": true, "splice-unquote": true, "macroexpand": true, "eval": true,
+	"macroexpand-1": true, "macroexpand-all": true, "def-dynamic!": true, "binding": true,
+	"lazy-seq": true,
+	"try*":     true, "catch*": true, "finally*": true, "ns": true,
+	"handler-bind": true, "restart-case": true, "&": true,
+}
+
+// quasiquoter expands one quasiquote form.
+type quasiquoter struct {
+	gensyms map[string]MalSymbol // by auto-gensym name, such as x#
+	replEnv *Env                 // qualify free symbols in this module, if not nil
+}
+
+// quasiquote expands ast as the body of a quasiquote evaluated in the
+// module of replEnv. Symbols ending with # are replaced by the same fresh
+// symbol throughout the expansion, and when *qualify-syntax-quote* is
+// true, other symbols are qualified by the module that defines them.
+func quasiquote(t *Thread, ast MalValue, replEnv *Env) (MalValue, error) {
+	q := &quasiquoter{gensyms: make(map[string]MalSymbol)}
+	if v, ok := t.get(replEnv, "*qualify-syntax-quote*"); ok && isTruthy(v) {
+		q.replEnv = replEnv
+	}
+	return q.expand(ast, false)
+}
+
+// symbol returns the symbol that sym stands for in a quasiquote.
+func (q *quasiquoter) symbol(sym MalSymbol) MalSymbol {
+	name := sym.Value
+	if strings.HasSuffix(name, "#") && len(name) > 1 {
+		g, ok := q.gensyms[name]
+		if !ok {
+			g = gensym(strings.TrimSuffix(name, "#") + "__")
+			g.Value += "__auto__"
+			q.gensyms[name] = g
+		}
+		return g
+	}
+	if q.replEnv == nil || specialForms[name] || strings.Contains(name, "/") || strings.HasPrefix(name, ".") {
+		return sym
+	}
+
+	state := q.replEnv.state
+	m := q.replEnv.module
+	if _, ok := m.Env.M[name]; !ok {
+		if _, ok := state.core.M[name]; ok {
+			m = state.core.module
+		}
+	}
+	return makeSymbol(m.Name + "/" + name)
+}
+
+// core returns the symbol naming the builtin name in an expansion.
+func (q *quasiquoter) core(name string) MalSymbol {
+	if q.replEnv == nil {
+		return makeSymbol(name)
+	}
+	return makeSymbol(CoreModuleName + "/" + name)
+}
+
+func (q *quasiquoter) expand(ast MalValue, ignoreUnquote bool) (MalValue, error) {
+	switch a := ast.(type) {
 	case MalList:
-		if q.IsVector() {
-			asList := NewList(q.Values)
-			qq, err := quasiquote(asList, true)
+		if a.IsVector() {
+			asList := NewList(a.Values)
+			qq, err := q.expand(asList, true)
 			if err != nil {
 				return nil, err
 			}
 			return MalList{
 				Values: []MalValue{
-					makeSymbol("vec"),
+					q.core("vec"),
 					qq,
 				},
 			}, nil
 		}
 
-		if len(q.Values) > 0 {
-			sym, ok := q.Values[0].(MalSymbol)
+		if len(a.Values) > 0 {
+			sym, ok := a.Values[0].(MalSymbol)
 			if !ignoreUnquote && ok && sym.Value == "unquote" {
-				if len(q.Values) != 2 {
-					return nil, fmt.Errorf("wrong number of arguments for unquote")
+				if len(a.Values) != 2 {
+					return nil, fmt.Errorf("%w for unquote", ErrWrongFuncNArgs)
 				}
-				return q.Values[1], nil
+				return a.Values[1], nil
 			}
 
 			result := MalList{Values: make([]MalValue, 0)}
-			for i := len(q.Values) - 1; i >= 0; i-- {
-				elt := q.Values[i]
+			for i := len(a.Values) - 1; i >= 0; i-- {
+				elt := a.Values[i]
 				switch e := elt.(type) {
 				case MalList:
 					if len(e.Values) > 0 {
@@ -875,11 +983,11 @@ func quasiquote(ast MalValue, ignoreUnquote bool) (MalValue, error) {
 
 						if ok && sym.Value == "splice-unquote" {
 							if len(e.Values) != 2 {
-								return nil, fmt.Errorf("wrong number of arguments for splice-unquote")
+								return nil, fmt.Errorf("%w for splice-unquote", ErrWrongFuncNArgs)
 							}
 							result = MalList{
 								Values: []MalValue{
-									makeSymbol("concat"),
+									q.core("concat"),
 									e.Values[1],
 									result,
 								},
@@ -888,13 +996,13 @@ func quasiquote(ast MalValue, ignoreUnquote bool) (MalValue, error) {
 						}
 					}
 				}
-				eltQuasi, err := quasiquote(elt, false)
+				eltQuasi, err := q.expand(elt, false)
 				if err != nil {
 					return nil, err
 				}
 				result = MalList{
 					Values: []MalValue{
-						makeSymbol("cons"),
+						q.core("cons"),
 						eltQuasi,
 						result,
 					},
@@ -908,7 +1016,7 @@ func quasiquote(ast MalValue, ignoreUnquote bool) (MalValue, error) {
 		return MalList{
 			Values: []MalValue{
 				makeSymbol("quote"),
-				ast,
+				q.symbol(a),
 			},
 		}, nil
 	case *MalMap:
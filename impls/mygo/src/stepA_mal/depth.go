@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// DefaultMaxDepth is well below the depth at which the Go runtime
+// aborts with a fatal stack overflow. It can be overridden with the
+// MAL_MAX_DEPTH environment variable.
+const DefaultMaxDepth = 200000
+
+// stackOverflowFrames is the number of innermost calls reported in
+// a stack overflow error.
+const stackOverflowFrames = 20
+
+func NewEvalState() *EvalState {
+	maxDepth := DefaultMaxDepth
+	if n, err := strconv.Atoi(os.Getenv("MAL_MAX_DEPTH")); err == nil && n > 0 {
+		maxDepth = n
+	}
+	return &EvalState{MaxDepth: maxDepth, modules: make(map[string]*Module), expansions: make(map[callSite]MalValue), rng: newRandom()}
+}
+
+// enterEval records a nested eval call, failing with :stack-overflow
+// once MaxDepth is reached. Each successful call must be paired with leaveEval.
+func (t *Thread) enterEval() error {
+	if len(t.calls) >= t.state.MaxDepth {
+		return t.stackOverflow()
+	}
+	t.calls = append(t.calls, "")
+	return nil
+}
+
+func (t *Thread) leaveEval() {
+	t.calls = t.calls[:len(t.calls)-1]
+}
+
+// applying records that the innermost eval call is applying the named function.
+func (t *Thread) applying(name string) {
+	t.calls[len(t.calls)-1] = name
+}
+
+func (t *Thread) stackOverflow() *MalError {
+	stack := []MalValue{}
+	for i := len(t.calls) - 1; i >= 0 && len(stack) < stackOverflowFrames; i-- {
+		if t.calls[i] != "" {
+			stack = append(stack, NewString(t.calls[i]))
+		}
+	}
+	data := NewMap()
+	data.Set(NewKeyword("depth"), MalInt{Value: int64(len(t.calls))})
+	data.Set(NewKeyword("stack"), NewVector(stack))
+
+	e := NewKindError(ErrKindStackOverflow, fmt.Sprintf("stack overflow: eval depth exceeded %d", t.state.MaxDepth))
+	e.data = data
+	e.value = e
+	return e
+}
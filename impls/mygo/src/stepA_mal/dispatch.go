@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// HostLanguage is the root value of *host-language*. Reader conditionals
+// read the form of the lower case keyword of *host-language*, :go unless
+// it is bound, or else of :default.
+const HostLanguage = "Go"
+
+// A DispatchFn reads the form of the reader macro #name, once the token
+// #name is consumed. For the macros written # followed by a delimiter, such
+// as #( and #', name is the delimiter, which is left to read. A DispatchFn
+// returns ErrReadNoForm when the macro reads as nothing, as #_ does.
+type DispatchFn func(r *Reader) (MalValue, error)
+
+// dispatchTable holds the reader macros of code by name. Other names are
+// read as tagged literals.
+var dispatchTable = map[string]DispatchFn{}
+
+// RegisterDispatch makes fn read the reader macro #name in code, replacing
+// any macro of that name.
+func RegisterDispatch(name string, fn DispatchFn) {
+	dispatchTable[name] = fn
+}
+
+func init() {
+	RegisterDispatch("(", readFnLiteral)
+	RegisterDispatch("'", readVarQuote)
+	RegisterDispatch("?", readConditional)
+}
+
+// readDispatch reads a form starting with #. Sets, discarded forms,
+// symbolic floats, namespaced maps and tagged literals are read in code as
+// in EDN, and the macros of dispatchTable in code only.
+func (r *Reader) readDispatch() (MalValue, error) {
+	token, _ := r.Next()
+	name := token[1:]
+	switch {
+	case strings.HasPrefix(token, "#_"):
+		if rest := token[2:]; rest != "" {
+			// #_form, read back as form
+			r.Position--
+			r.Tokens[r.Position] = rest
+		}
+		if _, err := r.ReadForm(); err != nil {
+			return nil, err
+		}
+		return nil, ErrReadNoForm
+	case token == "##Inf":
+		return NewFloat(math.Inf(1)), nil
+	case token == "##-Inf":
+		return NewFloat(math.Inf(-1)), nil
+	case token == "##NaN":
+		return NewFloat(math.NaN()), nil
+	case strings.HasPrefix(token, "##"):
+		return nil, fmt.Errorf("unknown symbolic value %s", token)
+	case strings.HasPrefix(token, "#:"):
+		return r.readNamespacedMap(token[2:])
+	case name == "":
+		peek, err := r.Peek()
+		if err != nil {
+			return nil, errors.New("unexpected #")
+		}
+		name = peek
+	}
+	if name == "{" {
+		return r.ReadList(ListTypeSet)
+	}
+	if r.edn == nil {
+		if fn, ok := dispatchTable[name]; ok {
+			return fn(r)
+		}
+	}
+	if token == "#" {
+		return nil, fmt.Errorf("unexpected #%s", name)
+	}
+	return r.readTagged(name)
+}
+
+// fnLiteralArgs are the parameters of the function literal being read.
+type fnLiteralArgs struct {
+	params []MalSymbol // for %1, %2...
+	rest   *MalSymbol  // for %&
+}
+
+// param returns the parameter named by the symbol sym, if any.
+func (a *fnLiteralArgs) param(sym MalSymbol) (MalSymbol, bool) {
+	if sym.Value == "%&" {
+		if a.rest == nil {
+			rest := gensym("rest__")
+			a.rest = &rest
+		}
+		return *a.rest, true
+	}
+	if !strings.HasPrefix(sym.Value, "%") {
+		return MalSymbol{}, false
+	}
+	n := 1
+	if sym.Value != "%" {
+		var err error
+		if n, err = strconv.Atoi(sym.Value[1:]); err != nil || n < 1 {
+			return MalSymbol{}, false
+		}
+	}
+	for len(a.params) < n {
+		a.params = append(a.params, gensym(fmt.Sprintf("p%d__", len(a.params)+1)))
+	}
+	return a.params[n-1], true
+}
+
+// replace returns form with its parameter symbols replaced.
+func (a *fnLiteralArgs) replace(form MalValue) (MalValue, error) {
+	switch f := form.(type) {
+	case MalSymbol:
+		if p, ok := a.param(f); ok {
+			return p, nil
+		}
+		return f, nil
+	case MalList:
+		values := make([]MalValue, len(f.Values))
+		for i, v := range f.Values {
+			var err error
+			if values[i], err = a.replace(v); err != nil {
+				return nil, err
+			}
+		}
+		return MalList{Values: values, Vector: f.Vector, Meta: f.Meta}, nil
+	case *MalMap:
+		m := NewMap()
+		for _, kv := range f.Iter() {
+			k, err := a.replace(kv.Key)
+			if err != nil {
+				return nil, err
+			}
+			v, err := a.replace(kv.Value)
+			if err != nil {
+				return nil, err
+			}
+			m.Set(k, v)
+		}
+		m.SetMeta(f.GetMeta())
+		return m, nil
+	case *MalSet:
+		items := f.items()
+		for i, v := range items {
+			var err error
+			if items[i], err = a.replace(v); err != nil {
+				return nil, err
+			}
+		}
+		return (&MalSet{meta: f.meta}).Conj(items), nil
+	case *MalSortedSet:
+		items := sortedItems(f)
+		for i, v := range items {
+			var err error
+			if items[i], err = a.replace(v); err != nil {
+				return nil, err
+			}
+		}
+		return (&MalSortedSet{tree: sortedTree{cmp: f.tree.cmp}, meta: f.meta}).Conj(items)
+	default:
+		return form, nil
+	}
+}
+
+// readFnLiteral reads #(body...) as (fn* (params...) (body...)), where the
+// parameters are the symbols %1, %2... up to the highest one of body, %
+// standing for %1, and & %& if body has %&.
+func readFnLiteral(r *Reader) (MalValue, error) {
+	if r.fnLiteral {
+		return nil, errors.New("nested #() are not allowed")
+	}
+	r.fnLiteral = true
+	defer func() {
+		r.fnLiteral = false
+	}()
+	body, err := r.ReadList(ListTypeList)
+	if err != nil {
+		return nil, err
+	}
+	args := &fnLiteralArgs{}
+	if body, err = args.replace(body); err != nil {
+		return nil, err
+	}
+	params := []MalValue{}
+	for _, p := range args.params {
+		params = append(params, p)
+	}
+	if args.rest != nil {
+		params = append(params, makeSymbol("&"), *args.rest)
+	}
+	return NewList([]MalValue{makeSymbol("fn*"), NewList(params), body}), nil
+}
+
+// readVarQuote reads #'name as (var name).
+func readVarQuote(r *Reader) (MalValue, error) {
+	r.Next() // consume "'"
+	form, err := r.ReadForm()
+	if err != nil {
+		return nil, err
+	}
+	return NewList([]MalValue{makeSymbol("var"), form}), nil
+}
+
+// codeReader returns a reader of the code in input, whose reader
+// conditionals read the form of *host-language* as bound in t.
+func (t *Thread) codeReader(input string) *Reader {
+	r := NewReader(Tokenize(input))
+	if v, ok := t.get(t.CurrentEnv(), "*host-language*"); ok {
+		if s, ok := v.(MalString); ok && !s.IsKeyword() {
+			r.host = strings.ToLower(s.Value)
+		}
+	}
+	return r
+}
+
+// readConditional reads #?(feature form...) as the form of the first
+// feature that is the host of r or :default, or as nothing if there is
+// none.
+func readConditional(r *Reader) (MalValue, error) {
+	if peek, err := r.Peek(); err != nil || peek != "(" {
+		return nil, errors.New("expected a list after #?")
+	}
+	form, err := r.ReadList(ListTypeList)
+	if err != nil {
+		return nil, err
+	}
+	clauses := form.(MalList).Values
+	if len(clauses)%2 != 0 {
+		return nil, errors.New("odd number of forms in reader conditional")
+	}
+	for i := 0; i < len(clauses); i += 2 {
+		feature, _ := clauses[i].(MalString)
+		name, err := feature.AsKeyword()
+		if err != nil {
+			return nil, fmt.Errorf("expected a keyword in reader conditional, got %s", PrStr(clauses[i], true))
+		}
+		if name == r.host || name == "default" {
+			return clauses[i+1], nil
+		}
+	}
+	return nil, ErrReadNoForm
+}
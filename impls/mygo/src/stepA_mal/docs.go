@@ -0,0 +1,560 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// builtinDoc documents a builtin. arglists is read as a list of parameter
+// vectors.
+type builtinDoc struct {
+	arglists string
+	doc      string
+}
+
+// builtinDocs documents the builtins of InitialEnv by name.
+var builtinDocs = map[string]builtinDoc{
+	// arithmetic and comparison
+	"+":  {"([& xs])", "Returns the sum of xs, 0 if there are none. The result is a float if any of xs is."},
+	"-":  {"([x] [x & ys])", "Returns x minus the sum of ys, or the negation of x if there are no ys. The result is a float if any of the numbers is."},
+	"*":  {"([& xs])", "Returns the product of xs, 1 if there are none. The result is a float if any of xs is."},
+	"/":  {"([x] [x & ys])", "Returns x divided by each of ys in turn, or 1 divided by x if there are no ys. Each division is truncated if both numbers are integers."},
+	"<":  {"([a b])", "Returns true if a is less than b."},
+	"<=": {"([a b])", "Returns true if a is less than or equal to b."},
+	">":  {"([a b])", "Returns true if a is greater than b."},
+	">=": {"([a b])", "Returns true if a is greater than or equal to b."},
+	"=":  {"([a b])", "Returns true if a and b are equal. Lists and vectors with equal elements are equal."},
+
+	// collections
+	"list":        {"([& items])", "Returns a list of items."},
+	"vector":      {"([& items])", "Returns a vector of items."},
+	"vec":         {"([coll])", "Returns a vector of the elements of coll."},
+	"hash-map":    {"([& kvs])", "Returns a map of the keys and values kvs."},
+	"count":       {"([coll])", "Returns the number of elements in coll. (count nil) is 0."},
+	"empty?":      {"([coll])", "Returns true if coll is nil or has no elements."},
+	"cons":        {"([x coll])", "Returns a sequence of x followed by the elements of coll, lazy if coll is."},
+	"concat":      {"([& colls])", "Returns a sequence of the elements of colls in order, lazy if any of them is."},
+	"conj":        {"([] [coll] [coll & xs])", "Returns coll with xs added, at the front of a list or sequence, the end of a vector, to a set, or as [key value] entries of a map."},
+	"nth":         {"([coll index])", "Returns the element of coll at index, or throws :index-out-of-bounds."},
+	"first":       {"([coll])", "Returns the first element of coll, or nil."},
+	"rest":        {"([coll])", "Returns a sequence of the elements of coll after the first."},
+	"seq":         {"([coll])", "Returns a sequence of the elements of coll, the characters of a string or the [key value] entries of a map, or nil if there are none."},
+	"assoc":       {"([coll & kvs])", "Returns the map or vector coll with the keys and values kvs added. A vector key is an index."},
+	"dissoc":      {"([map & keys])", "Returns map without keys."},
+	"get":         {"([coll key] [coll key not-found])", "Returns the value of key in a map, the element key of a set, or the element at index key of a vector or string, or not-found."},
+	"contains?":   {"([coll key])", "Returns true if the map coll has key, or if key is an index of the vector or string coll."},
+	"keys":        {"([map])", "Returns a list of the keys of map."},
+	"vals":        {"([map])", "Returns a list of the values of map."},
+	"apply":       {"([f & args coll])", "Calls f with args followed by the elements of coll."},
+	"map":         {"([f] [f coll] [f coll & colls])", "Returns a transducer, or returns the results of calling f on the first elements of the colls, then on the second ones, until one is exhausted. Lazy if any coll is."},
+	"meta":        {"([x])", "Returns the metadata of x, or nil."},
+	"with-meta":   {"([x meta])", "Returns a copy of x with the metadata meta."},
+	"vary-meta":   {"([x f & args])", "Returns a copy of x with the metadata (f (meta x) args...)."},
+	"symbol":      {"([name])", "Returns the symbol called name."},
+	"keyword":     {"([name])", "Returns the keyword called name."},
+	"gensym":      {"([] [prefix])", "Returns a new symbol with a unique name starting with prefix, G__ by default."},
+	"read-string": {"([s])", "Reads the first form in the string s."},
+
+	// lazy sequences
+	"iterate":    {"([f x])", "Returns the infinite lazy sequence x, (f x), (f (f x)), ..."},
+	"repeat":     {"([x] [n x])", "Returns an infinite lazy sequence of x, or a list of n x."},
+	"cycle":      {"([coll])", "Returns an infinite lazy sequence of the elements of coll repeated."},
+	"range":      {"([] [end] [start end] [start end step])", "Returns a lazy sequence of the numbers from start, 0 by default, to end exclusive by step, 1 by default. Without end, the sequence is infinite."},
+	"take":       {"([n] [n coll])", "Returns a transducer, or returns a lazy sequence of the first n elements of coll."},
+	"drop":       {"([n] [n coll])", "Returns a transducer, or returns a lazy sequence of the elements of coll after the first n."},
+	"take-while": {"([pred] [pred coll])", "Returns a transducer, or returns a lazy sequence of the elements of coll while (pred x) is true."},
+	"doall":      {"([coll])", "Realizes all of the lazy sequence coll and returns it."},
+	"realized?":  {"([s])", "Returns true if the lazy sequence s was computed."},
+
+	// sequence library
+	"reduce":      {"([f coll] [f init coll])", "Returns (f (f init x1) x2)... over the elements of coll. Without init, starts from the first element, and returns (f) if coll is empty."},
+	"filter":      {"([pred] [pred coll])", "Returns a transducer, or returns the elements of coll for which (pred x) is true, lazily if coll is lazy."},
+	"remove":      {"([pred] [pred coll])", "Returns a transducer, or returns the elements of coll for which (pred x) is false, lazily if coll is lazy."},
+	"some":        {"([pred coll])", "Returns the first true value of (pred x) over coll, or nil."},
+	"every?":      {"([pred coll])", "Returns true if (pred x) is true for every element of coll."},
+	"partition":   {"([n coll] [n step coll] [n step pad coll])", "Returns lists of n elements of coll, starting every step elements. An incomplete last list is dropped, or completed from pad if given."},
+	"group-by":    {"([f coll])", "Returns a map of each (f x) to a vector of the elements x of coll giving it, in order."},
+	"frequencies": {"([coll])", "Returns a map of each distinct element of coll to its number of occurrences."},
+	"distinct":    {"([] [coll])", "Returns a transducer, or returns the elements of coll without duplicates, lazily if coll is lazy."},
+	"sort":        {"([coll] [cmp coll])", "Returns the elements of coll sorted by cmp, which returns a number like compare or is a predicate like <. The sort is stable."},
+	"sort-by":     {"([keyfn coll] [keyfn cmp coll])", "Returns the elements of coll sorted by their (keyfn x)."},
+	"reverse":     {"([coll])", "Returns a list of the elements of coll in reverse order."},
+	"interleave":  {"([& colls])", "Returns the first elements of colls, then the second ones, until one is exhausted. Lazy if any coll is."},
+	"zipmap":      {"([keys vals])", "Returns a map of keys to the vals at the same positions."},
+	"merge":       {"([& maps])", "Returns the first non-nil map with the entries of the later maps added, or nil."},
+	"update":      {"([m k f & args])", "Returns m with the value v of k replaced by (f v args...)."},
+	"get-in":      {"([m ks] [m ks not-found])", "Returns the value in nested collections m at the path of keys ks, or not-found."},
+	"assoc-in":    {"([m ks v])", "Returns m with v at the path of keys ks, creating maps as needed."},
+	"update-in":   {"([m ks f & args])", "Returns m with the value v at the path of keys ks replaced by (f v args...)."},
+
+	// ordering and sorted collections
+	"compare":       {"([a b])", "Returns a negative number, zero or a positive number as a is less than, equal to or greater than b. Values of different types are ordered nil, booleans, numbers, strings, keywords, symbols, lists and vectors, sets, maps, instants and UUIDs. An integer is less than an equal float. Lists, vectors and sets compare by size and then element by element, and maps by size and then by their entries in key order. Only values that are = compare as zero; NaN, functions, atoms and other values without an order raise a :type-error."},
+	"sorted-map":    {"([& kvs])", "Returns a map of the keys and values kvs, ordered by compare on the keys."},
+	"sorted-map-by": {"([cmp & kvs])", "Returns a map of the keys and values kvs, ordered by cmp on the keys."},
+	"sorted-set":    {"([& xs])", "Returns a set of xs, ordered by compare."},
+	"sorted-set-by": {"([cmp & xs])", "Returns a set of xs, ordered by cmp."},
+	"sorted?":       {"([x])", "Returns true if x is a sorted map or set."},
+	"set?":          {"([x])", "Returns true if x is a set."},
+	"disj":          {"([set & xs])", "Returns set without xs."},
+	"subseq":        {"([sc test key] [sc start-test start-key end-test end-key])", "Returns the elements of the sorted collection sc, or entries of a sorted map, whose key k passes (test (compare k key) 0), in order, or nil. test is one of <, <=, > and >=."},
+	"rsubseq":       {"([sc test key] [sc start-test start-key end-test end-key])", "Returns the elements of subseq in reverse order."},
+
+	// transducers
+	"reduced":    {"([x])", "Wraps x so that reduce and transduce stop and return x."},
+	"reduced?":   {"([x])", "Returns true if x was made by reduced."},
+	"unreduced":  {"([x])", "Returns the value wrapped by reduced, or x."},
+	"cat":        {"([rf])", "A transducer adding the elements of each input collection."},
+	"identity":   {"([x])", "Returns x."},
+	"comp":       {"([& fs])", "Returns the composition of fs, calling the last one first. Composed transducers transform inputs from left to right."},
+	"completing": {"([f] [f cf])", "Returns f with a completion arity calling cf, identity by default."},
+	"transduce":  {"([xf f coll] [xf f init coll])", "Reduces coll with (xf f) from init, (f) by default, and completes the result."},
+	"into":       {"([] [to] [to from] [to xf from])", "Returns to with the elements of from, transformed by xf, added as by conj."},
+	"sequence":   {"([coll] [xf coll])", "Returns the elements of coll, transformed by xf, lazily if coll is lazy."},
+
+	// regexes
+	"re-pattern": {"([s])", "Returns the regex compiled from the pattern s, with the syntax of Go's regexp package. #\"pattern\" reads as a regex."},
+	"re-find":    {"([re s])", "Returns the first match of re in s, or nil. A match is the matched string, or a vector of it followed by the groups if re has groups."},
+	"re-matches": {"([re s])", "Returns the match of re if it matches all of s, or nil."},
+	"re-seq":     {"([re s])", "Returns a list of the successive matches of re in s, or nil."},
+	"re-groups":  {"([re s])", "Returns a map of the names of the named groups of re, as keywords, to their text in the first match in s, or nil."},
+	"regex?":     {"([x])", "Returns true if x is a regex."},
+
+	// string module
+	"string/split":        {"([s sep] [s sep limit])", "Returns a vector of the parts of s between occurrences of sep, a string or a regex. With a positive limit, returns at most limit parts; otherwise trailing empty parts are removed."},
+	"string/split-lines":  {"([s])", "Returns a vector of the lines of s, split at \\n or \\r\\n."},
+	"string/join":         {"([coll] [sep coll])", "Returns the elements of coll converted as by str, separated by sep."},
+	"string/trim":         {"([s])", "Returns s without whitespace at both ends."},
+	"string/triml":        {"([s])", "Returns s without whitespace at the start."},
+	"string/trimr":        {"([s])", "Returns s without whitespace at the end."},
+	"string/upper-case":   {"([s])", "Returns s in upper case."},
+	"string/lower-case":   {"([s])", "Returns s in lower case."},
+	"string/reverse":      {"([s])", "Returns the characters of s in reverse order."},
+	"string/starts-with?": {"([s prefix])", "Returns true if s starts with prefix."},
+	"string/ends-with?":   {"([s suffix])", "Returns true if s ends with suffix."},
+	"string/includes?":    {"([s x])", "Returns true if s contains x."},
+	"string/index-of":     {"([s x] [s x from])", "Returns the index of the first occurrence of x in s at or after from, or nil."},
+	"string/replace":      {"([s match replacement])", "Returns s with every occurrence of the string or regex match replaced. For a regex, $1 or ${name} in replacement stand for groups, and replacement may be a function of the match as returned by re-find."},
+	"string/subs":         {"([s start] [s start end])", "Returns the characters of s from start to end exclusive, or to the end of s."},
+	"string/pad":          {"([s width] [s width side] [s width side fill])", "Returns s completed to width characters with fill, a space by default, on side :right (the default), :left or :center."},
+
+	// math module
+	"math/quot":                     {"([a b])", "Returns a divided by b, rounded toward zero."},
+	"math/rem":                      {"([a b])", "Returns the remainder of dividing a by b, with the sign of a."},
+	"math/mod":                      {"([a b])", "Returns a modulo b, with the sign of b."},
+	"math/abs":                      {"([x])", "Returns the absolute value of x."},
+	"math/min":                      {"([x & xs])", "Returns the least of the numbers given."},
+	"math/max":                      {"([x & xs])", "Returns the greatest of the numbers given."},
+	"math/sqrt":                     {"([x])", "Returns the square root of x."},
+	"math/cbrt":                     {"([x])", "Returns the cube root of x."},
+	"math/pow":                      {"([x y])", "Returns x raised to the power y."},
+	"math/exp":                      {"([x])", "Returns e raised to the power x."},
+	"math/log":                      {"([x])", "Returns the natural logarithm of x."},
+	"math/log10":                    {"([x])", "Returns the base 10 logarithm of x."},
+	"math/sin":                      {"([x])", "Returns the sine of x radians."},
+	"math/cos":                      {"([x])", "Returns the cosine of x radians."},
+	"math/tan":                      {"([x])", "Returns the tangent of x radians."},
+	"math/asin":                     {"([x])", "Returns the arcsine of x, in radians."},
+	"math/acos":                     {"([x])", "Returns the arccosine of x, in radians."},
+	"math/atan":                     {"([x])", "Returns the arctangent of x, in radians."},
+	"math/atan2":                    {"([y x])", "Returns the angle of the point (x, y) from the x axis, in radians."},
+	"math/floor":                    {"([x])", "Returns the greatest integral float not above x."},
+	"math/ceil":                     {"([x])", "Returns the least integral float not below x."},
+	"math/round":                    {"([x])", "Returns the integer nearest to x, rounding halves away from zero."},
+	"math/bit-and":                  {"([x & xs])", "Returns the bitwise and of the integers given."},
+	"math/bit-or":                   {"([x & xs])", "Returns the bitwise or of the integers given."},
+	"math/bit-xor":                  {"([x & xs])", "Returns the bitwise exclusive or of the integers given."},
+	"math/bit-and-not":              {"([x & xs])", "Returns x with the bits set in xs cleared."},
+	"math/bit-not":                  {"([x])", "Returns the bitwise complement of x."},
+	"math/bit-shift-left":           {"([x n])", "Returns x shifted left by n bits."},
+	"math/bit-shift-right":          {"([x n])", "Returns x shifted right by n bits, keeping its sign."},
+	"math/unsigned-bit-shift-right": {"([x n])", "Returns x shifted right by n bits, filling with zeros."},
+	"math/seed!":                    {"([seed])", "Reseeds the random generator of the interpreter, so that the random builtins repeat the same results."},
+	"math/rand":                     {"([] [n])", "Returns a random float from 0 inclusive to n exclusive, 1 by default."},
+	"math/rand-int":                 {"([n])", "Returns a random integer from 0 inclusive to n exclusive."},
+	"math/rand-nth":                 {"([coll])", "Returns a random element of coll."},
+	"math/shuffle":                  {"([coll])", "Returns a vector of the elements of coll in random order."},
+
+	// json module
+	"json/read-str":  {"([s & opts])", "Returns the JSON value in s. Arrays are read as vectors, objects as maps, and numbers as integers unless they have a fraction or an exponent. Integers out of the range of 64 bits are a :read-error. The option :key-fn is applied to object keys, e.g. :key-fn keyword."},
+	"json/read":      {"([path & opts])", "Returns a lazy sequence of the successive JSON values in the file at path, which is read whole and closed at once, or in the standard input if path is nil, which is read as the values are needed. Takes the options of read-str."},
+	"json/write-str": {"([x & opts])", "Returns x written as JSON. Keywords and symbols are written as strings, sequences and sets as arrays, and floats so that they read back as the same float. With :pretty true, the output is indented."},
+
+	// edn module
+	"edn/read-string":  {"([s] [opts s])", "Returns the first EDN value in s, or nil if there is none, without evaluating anything. Tagged literals are read by the functions of *data-readers*, the map :readers of opts, then #inst and #uuid, then the function :default of opts, called with the tag and the form."},
+	"edn/write-string": {"([x])", "Returns x written as EDN, failing on values that EDN cannot represent, such as functions and atoms."},
+
+	// predicates
+	"nil?":        {"([x])", "Returns true if x is nil."},
+	"true?":       {"([x])", "Returns true if x is true."},
+	"false?":      {"([x])", "Returns true if x is false."},
+	"symbol?":     {"([x])", "Returns true if x is a symbol."},
+	"keyword?":    {"([x])", "Returns true if x is a keyword."},
+	"string?":     {"([x])", "Returns true if x is a string and not a keyword."},
+	"number?":     {"([x])", "Returns true if x is a number."},
+	"fn?":         {"([x])", "Returns true if x is a function and not a macro."},
+	"macro?":      {"([x])", "Returns true if x is a macro."},
+	"list?":       {"([x])", "Returns true if x is a list."},
+	"vector?":     {"([x])", "Returns true if x is a vector."},
+	"sequential?": {"([x])", "Returns true if x is a list, a vector or a lazy sequence."},
+	"map?":        {"([x])", "Returns true if x is a map."},
+	"atom?":       {"([x])", "Returns true if x is an atom."},
+
+	// atoms
+	"atom":        {"([x] [x :meta meta])", "Returns an atom holding x, with the metadata meta."},
+	"alter-meta!": {"([atom f & args])", "Sets the metadata of atom to (f (meta atom) args...) and returns it."},
+	"reset-meta!": {"([atom meta])", "Sets the metadata of atom to meta and returns it."},
+	"deref":       {"([ref])", "Returns the value held by an atom or a reduced value. @ref reads as (deref ref)."},
+	"reset!":      {"([atom x])", "Sets the value held by atom to x and returns x."},
+	"swap!":       {"([atom f & args])", "Sets the value held by atom to (f value args...) and returns it."},
+
+	// errors and conditions
+	"throw":            {"([x])", "Throws x. A thrown keyword is its own error kind."},
+	"ex-info":          {"([msg data] [msg data cause])", "Returns an error with the message msg and the map data. A :kind keyword in data sets the kind of the error."},
+	"ex-message":       {"([e])", "Returns the message of the error e. In a catch* body, e may also be the value bound for the caught error."},
+	"ex-data":          {"([e])", "Returns the data of the error e, or nil. In a catch* body, e may also be the value bound for the caught error."},
+	"ex-cause":         {"([e])", "Returns the error that caused e, or nil. In a catch* body, e may also be the value bound for the caught error."},
+	"ex-kind":          {"([e])", "Returns the kind of the error e as a keyword. In a catch* body, e may also be the value bound for the caught error."},
+	"signal":           {"([condition])", "Calls the handlers established by handler-bind that match condition, and returns nil if none of them invokes a restart."},
+	"error":            {"([condition])", "Signals condition, then throws it if no handler invoked a restart."},
+	"invoke-restart":   {"([name & args])", "Transfers control to the innermost restart called name, established by restart-case, passing it args."},
+	"compute-restarts": {"([])", "Returns the names of the active restarts, innermost first."},
+
+	// input and output
+	"pr-str":     {"([& xs])", "Returns xs printed readably and separated by spaces."},
+	"str":        {"([& xs])", "Returns xs printed for humans and concatenated."},
+	"prn":        {"([& xs])", "Prints xs readably, separated by spaces, followed by a newline."},
+	"prnn":       {"([x])", "Prints x readably, without a newline."},
+	"print":      {"([& xs])", "Prints xs for humans, separated by spaces."},
+	"println":    {"([& xs])", "Prints xs for humans, separated by spaces, followed by a newline."},
+	"pprint":     {"([x] [x width])", "Pretty prints x within width columns, *print-right-margin* by default."},
+	"pprint-str": {"([x] [x width])", "Returns x pretty printed within width columns, *print-right-margin* by default."},
+	"format":     {"([fmt & args])", "Returns args formatted by the directives of fmt, such as %s, %v (readably), %d, %x, %.2f and %-10s."},
+	"printf":     {"([fmt & args])", "Prints args formatted by the directives of fmt, as format does."},
+	"cl-format":  {"([dest fmt & args])", "Formats args by the directives of fmt: ~a, ~s, ~d, ~%, ~{...~} over a list and ~^ to stop before its end. Returns the string if dest is nil, and prints it if dest is true."},
+	"readline":   {"([prompt])", "Prints prompt and returns the next line of standard input, or nil at the end."},
+	"slurp":      {"([path])", "Returns the contents of the file at path."},
+	"time-ms":    {"([])", "Returns the current time in milliseconds since the Unix epoch."},
+
+	// namespaces and dynamic vars
+	"require":   {"([& specs])", "Loads modules into the current namespace. A spec is a symbol or a vector such as [foo.bar :as fb :refer [x y]]."},
+	"load-file": {"([path])", "Evaluates the forms in the file at path."},
+	"ns-name":   {"([])", "Returns the name of the current namespace."},
+	"bound-fn*": {"([f])", "Returns a function that calls f with the dynamic bindings in effect now."},
+
+	// introspection
+	"var-meta":     {"([name])", "Returns the metadata of the definition of the symbol name, such as :doc and :arglists."},
+	"apropos":      {"([s])", "Returns the qualified names of the definitions whose name contains the string s."},
+	"ns-publics":   {"([ns])", "Returns a map of the names defined in the namespace ns to their values."},
+	"dir-fn":       {"([ns])", "Returns a sorted list of the names defined in the namespace ns."},
+	"print-doc":    {"([name])", "Prints the documentation of the definition or special form called name."},
+	"print-source": {"([name])", "Prints the source of the definition called name."},
+}
+
+// specialFormDocs documents the special forms, which have no definition.
+var specialFormDocs = map[string]builtinDoc{
+	"def!":             {"([name value] [name doc value])", "Defines name as value in the current environment."},
+	"defmacro!":        {"([name f] [name doc f])", "Defines name as a macro calling f."},
+	"def-dynamic!":     {"([name value] [name doc value])", "Defines name as a dynamic var, which binding can rebind."},
+	"let*":             {"([bindings body])", "Evaluates body with the names in bindings bound to their values, in order."},
+	"do":               {"([& body])", "Evaluates body in order and returns the last value."},
+	"if":               {"([test then] [test then else])", "Evaluates then if test is neither nil nor false, else evaluates else."},
+	"fn*":              {"([params body] [params doc body])", "Returns a function. A parameter & binds a list of the remaining arguments."},
+	"quote":            {"([form])", "Returns form unevaluated."},
+	"var":              {"([name])", "Returns the symbol name qualified by the namespace defining it, which var-meta and the other introspection builtins take. #'name reads as (var name)."},
+	"quasiquote":       {"([form])", "Returns form unevaluated except for (unquote x) and (splice-unquote xs). Symbols ending with # are replaced by fresh ones."},
+	"quasiquoteexpand": {"([form])", "Returns the expansion of (quasiquote form)."},
+	"macroexpand":      {"([form])", "Expands form while it is a macro call."},
+	"macroexpand-1":    {"([form])", "Expands form once if it is a macro call."},
+	"macroexpand-all":  {"([form])", "Expands all the macro calls in form."},
+	"eval":             {"([form])", "Evaluates the value of form in the current namespace."},
+	"try*":             {"([& body catch-clauses finally-clause])", "Evaluates body, handling errors with (catch* e handler) or (catch* filter e handler), and always evaluating (finally* body) last."},
+	"lazy-seq":         {"([& body])", "Returns a sequence computed by evaluating body when it is first needed. body returns a sequence or nil."},
+	"ns":               {"([name & clauses])", "Makes name the current namespace. A clause (:require specs...) requires modules."},
+	"binding":          {"([bindings & body])", "Evaluates body with the dynamic vars in bindings rebound."},
+	"handler-bind":     {"([bindings & body])", "Evaluates body with handlers for conditions matching each filter in bindings."},
+	"restart-case":     {"([expr & clauses])", "Evaluates expr with the restarts (name (params...) body...) available to invoke-restart."},
+}
+
+func (e *Env) setVarMeta(key string, meta *MalMap) {
+	if e.meta == nil {
+		e.meta = make(map[string]*MalMap)
+	}
+	e.meta[key] = meta
+}
+
+// defMeta returns the metadata of a definition made by the form def,
+// which may give a docstring doc and metadata meta for the name.
+func defMeta(name MalSymbol, val MalValue, doc MalValue, meta MalValue, def MalList, env *Env) *MalMap {
+	m := NewMap()
+	m.Set(NewKeyword("name"), name)
+	if env.module != nil {
+		m.Set(NewKeyword("ns"), makeSymbol(env.module.Name))
+	}
+	if f, ok := val.(MalTcoFunc); ok {
+		params := make([]MalValue, len(f.Params))
+		for i, p := range f.Params {
+			params[i] = makeSymbol(p)
+		}
+		m.Set(NewKeyword("arglists"), NewList([]MalValue{NewVector(params)}))
+		if fnMeta, ok := f.Fn.Meta.(*MalMap); ok {
+			if d, ok := fnMeta.Get(NewKeyword("doc")); ok && doc == nil {
+				doc = d
+			}
+		}
+	}
+	if doc != nil {
+		m.Set(NewKeyword("doc"), doc)
+	}
+	if meta, ok := meta.(*MalMap); ok {
+		for _, entry := range meta.Iter() {
+			m.Set(entry.Key, entry.Value)
+		}
+	}
+	m.Set(NewKeyword("source"), def)
+	return m
+}
+
+// builtinMeta returns the metadata of the builtin called name in the
+// module ns. Builtins outside the core module are documented under their
+// qualified name. Arglists that cannot be read, which TestBuiltinDocs
+// rules out, are left out.
+func builtinMeta(ns string, name string) *MalMap {
+	m := NewMap()
+	m.Set(NewKeyword("name"), makeSymbol(name))
+	m.Set(NewKeyword("ns"), makeSymbol(ns))
+	key := name
+	if ns != CoreModuleName {
+		key = ns + "/" + name
+	}
+	if d, ok := builtinDocs[key]; ok {
+		if arglists, err := ReadStr(d.arglists); err == nil {
+			m.Set(NewKeyword("arglists"), arglists)
+		}
+		m.Set(NewKeyword("doc"), NewString(d.doc))
+	}
+	return m
+}
+
+// findVar returns the environment defining name, which may be qualified,
+// as seen from env in the module of replEnv, and the unqualified name.
+func findVar(name string, replEnv *Env, env *Env) (*Env, string, bool) {
+	if e, ok := env.Find(name); ok {
+		return e, name, true
+	}
+	nsName, sym, ok := splitQualified(name)
+	if !ok {
+		return nil, "", false
+	}
+	if full, ok := replEnv.module.aliases[nsName]; ok {
+		nsName = full
+	}
+	m, ok := replEnv.state.findModule(nsName)
+	if !ok {
+		return nil, "", false
+	}
+	if _, ok := m.Env.M[sym]; !ok {
+		return nil, "", false
+	}
+	return m.Env, sym, true
+}
+
+// evalVar evaluates (var name), which returns name qualified by the module
+// defining it. Local bindings are not definitions.
+func evalVar(form MalValue, replEnv *Env, env *Env) (MalValue, error) {
+	sym, ok := form.(MalSymbol)
+	if !ok {
+		return nil, NewTypeError("MalSymbol", form)
+	}
+	e, name, ok := findVar(sym.Value, replEnv, env)
+	if !ok || e.module == nil {
+		return nil, NewKindError(ErrKindUnbound, fmt.Sprintf("unable to resolve var %s", sym.Value))
+	}
+	return MalSymbol{Value: e.module.Name + "/" + name}, nil
+}
+
+func symbolArg(args []MalValue) (MalSymbol, error) {
+	if len(args) != 1 {
+		return MalSymbol{}, ErrWrongFuncNArgs
+	}
+	sym, ok := args[0].(MalSymbol)
+	if !ok {
+		return MalSymbol{}, NewTypeError("MalSymbol", args[0])
+	}
+	return sym, nil
+}
+
+// printDoc writes the documentation in meta of the definition called
+// name, in the style of Clojure's doc.
+func printDoc(w io.Writer, name string, meta *MalMap, kind string) {
+	fmt.Fprintln(w, "-------------------------")
+	fmt.Fprintln(w, name)
+	if arglists, ok := meta.Get(NewKeyword("arglists")); ok {
+		fmt.Fprintln(w, PrStr(arglists, true))
+	}
+	if kind != "" {
+		fmt.Fprintln(w, kind)
+	}
+	if doc, ok := meta.Get(NewKeyword("doc")); ok {
+		if doc, ok := doc.(MalString); ok {
+			for _, line := range strings.Split(doc.Value, "\n") {
+				fmt.Fprintln(w, "  "+strings.TrimSpace(line))
+			}
+		}
+	}
+}
+
+// IntrospectionNamespace returns the builtins for exploring the
+// definitions of the interpreter of env. Names are resolved in the current
+// module of the calling thread.
+func IntrospectionNamespace(env *Env) Namespace {
+	m := make(map[MalSymbol]MalFunc)
+
+	varMeta := func(t *Thread, sym MalSymbol) (*MalMap, string, bool) {
+		current := t.CurrentEnv()
+		e, name, ok := findVar(sym.Value, current, current)
+		if !ok {
+			return nil, "", false
+		}
+		meta, ok := e.meta[name]
+		if !ok {
+			return nil, "", false
+		}
+		qualified := name
+		if e.module != nil {
+			qualified = e.module.Name + "/" + name
+		}
+		return meta, qualified, true
+	}
+	module := func(t *Thread, args []MalValue) (*Module, error) {
+		sym, err := symbolArg(args)
+		if err != nil {
+			return nil, err
+		}
+		name := sym.Value
+		if full, ok := t.current.aliases[name]; ok {
+			name = full
+		}
+		mod, ok := env.state.findModule(name)
+		if !ok {
+			return nil, NewKindError(ErrKindNamespaceNotFound, fmt.Sprintf("namespace %s not found", sym.Value))
+		}
+		return mod, nil
+	}
+
+	m[makeSymbol("var-meta")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		sym, err := symbolArg(args)
+		if err != nil {
+			return nil, err
+		}
+		meta, _, ok := varMeta(t, sym)
+		if !ok {
+			return nil, nil
+		}
+		return meta, nil
+	})
+	m[makeSymbol("apropos")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		s, ok := args[0].(MalString)
+		if !ok || s.IsKeyword() {
+			return nil, NewTypeError("MalString", args[0])
+		}
+		names := []string{}
+		for _, mod := range env.state.moduleList() {
+			for name := range mod.Env.M {
+				if strings.Contains(name, s.Value) {
+					names = append(names, mod.Name+"/"+name)
+				}
+			}
+		}
+		sort.Strings(names)
+		syms := make([]MalValue, len(names))
+		for i, name := range names {
+			syms[i] = makeSymbol(name)
+		}
+		return NewList(syms), nil
+	})
+	m[makeSymbol("ns-publics")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		mod, err := module(t, args)
+		if err != nil {
+			return nil, err
+		}
+		publics := NewMap()
+		for name, v := range mod.Env.M {
+			publics.Set(makeSymbol(name), v)
+		}
+		return publics, nil
+	})
+	m[makeSymbol("dir-fn")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		mod, err := module(t, args)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(mod.Env.M))
+		for name := range mod.Env.M {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		syms := make([]MalValue, len(names))
+		for i, name := range names {
+			syms[i] = makeSymbol(name)
+		}
+		return NewList(syms), nil
+	})
+	m[makeSymbol("print-doc")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		sym, err := symbolArg(args)
+		if err != nil {
+			return nil, err
+		}
+		if meta, name, ok := varMeta(t, sym); ok {
+			kind := ""
+			if v, ok := meta.Get(NewKeyword("dynamic")); ok && isTruthy(v) {
+				kind = "Dynamic"
+			}
+			current := t.CurrentEnv()
+			if v, ok := lookupSymbol(t, sym.Value, current, current); ok && isMacro(v) {
+				kind = "Macro"
+			}
+			printDoc(os.Stdout, name, meta, kind)
+			return nil, nil
+		}
+		if d, ok := specialFormDocs[sym.Value]; ok {
+			meta := NewMap()
+			arglists, err := ReadStr(d.arglists)
+			if err != nil {
+				return nil, err
+			}
+			meta.Set(NewKeyword("arglists"), arglists)
+			meta.Set(NewKeyword("doc"), NewString(d.doc))
+			printDoc(os.Stdout, sym.Value, meta, "Special Form")
+			return nil, nil
+		}
+		return nil, NewKindError(ErrKindUnbound, fmt.Sprintf("'%s' not found", sym.Value))
+	})
+	m[makeSymbol("print-source")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		sym, err := symbolArg(args)
+		if err != nil {
+			return nil, err
+		}
+		meta, _, ok := varMeta(t, sym)
+		if !ok {
+			return nil, NewKindError(ErrKindUnbound, fmt.Sprintf("'%s' not found", sym.Value))
+		}
+		source, ok := meta.Get(NewKeyword("source"))
+		if !ok {
+			fmt.Println("Source not found")
+			return nil, nil
+		}
+		if err := PprWrite(os.Stdout, source, printOptionsFromEnv(t, t.CurrentEnv(), true), DefaultPrintWidth); err != nil {
+			return nil, err
+		}
+		fmt.Println()
+		return nil, nil
+	})
+
+	return Namespace{M: m}
+}
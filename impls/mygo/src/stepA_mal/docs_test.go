@@ -0,0 +1,16 @@
+package main
+
+import "testing"
+
+func TestBuiltinDocs(t *testing.T) {
+	for name, d := range builtinDocs {
+		arglists, err := ReadStr(d.arglists)
+		if err != nil {
+			t.Errorf("arglists of %s: %v", name, err)
+			continue
+		}
+		if l, ok := arglists.(MalList); !ok || len(l.Values) == 0 {
+			t.Errorf("arglists of %s is %s, want a non-empty list", name, d.arglists)
+		}
+	}
+}
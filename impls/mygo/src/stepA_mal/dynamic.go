@@ -0,0 +1,148 @@
+package main
+
+import "fmt"
+
+// dynVar identifies a dynamic var by the module or core environment
+// defining it.
+type dynVar struct {
+	env  *Env
+	name string
+}
+
+// bindings maps dynamic vars to the values given by the enclosing binding
+// forms of a thread. A map is never modified once installed, so that it
+// can be captured and reinstalled elsewhere, as bound-fn* does, or shared
+// with another thread.
+type bindings map[dynVar]MalValue
+
+func (e *Env) markDynamic(key string) {
+	if e.dynamic == nil {
+		e.dynamic = make(map[string]bool)
+	}
+	e.dynamic[key] = true
+}
+
+// value returns the value of key defined in e itself, which for a dynamic
+// var is its innermost binding in t.
+func (t *Thread) value(e *Env, key string) (MalValue, bool) {
+	if e.dynamic[key] {
+		if v, ok := t.bindings[dynVar{env: e, name: key}]; ok {
+			return v, true
+		}
+	}
+	v, ok := e.M[key]
+	return v, ok
+}
+
+// get returns the value of key in env as seen by t.
+func (t *Thread) get(env *Env, key string) (MalValue, bool) {
+	e, ok := env.Find(key)
+	if !ok {
+		return nil, false
+	}
+	return t.value(e, key)
+}
+
+// defName returns the symbol defined by (def! name value) and the
+// metadata it carries, such as ^:dynamic, if any.
+func defName(v MalValue) (MalSymbol, MalValue, error) {
+	if sym, ok := v.(MalSymbol); ok {
+		return sym, sym.Meta, nil
+	}
+	// ^meta name is read as (with-meta name meta)
+	l, ok := v.(MalList)
+	if ok && len(l.Values) == 3 && malEq(l.Values[0], makeSymbol("with-meta")) {
+		if sym, ok := l.Values[1].(MalSymbol); ok {
+			return sym, l.Values[2], nil
+		}
+	}
+	return MalSymbol{}, nil, syntaxError("arg0 of def! must be MalSymbol, got %v", v)
+}
+
+func isDynamicMeta(meta MalValue) bool {
+	if m, ok := meta.(*MalMap); ok {
+		v, ok := m.Get(NewKeyword("dynamic"))
+		return ok && isTruthy(v)
+	}
+	return false
+}
+
+// resolveDynamic returns the dynamic var named by sym.
+func resolveDynamic(sym MalSymbol, replEnv *Env, env *Env) (dynVar, error) {
+	e, name, ok := findVar(sym.Value, replEnv, env)
+	if !ok {
+		return dynVar{}, NewKindError(ErrKindUnbound, fmt.Sprintf("'%s' not found", sym.Value))
+	}
+	if !e.dynamic[name] {
+		return dynVar{}, NewKindError(ErrKindControl, fmt.Sprintf("can't dynamically bind non-dynamic var %s", sym.Value))
+	}
+	return dynVar{env: e, name: name}, nil
+}
+
+// evalBinding evaluates (binding (name value ...) body...). The new values
+// are seen by everything evaluated in the body, including the functions it
+// calls, and the previous ones are restored however the body exits.
+func evalBinding(t *Thread, args []MalValue, replEnv *Env, env *Env) (MalValue, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("%w for binding", ErrWrongFuncNArgs)
+	}
+	pairs, ok := args[0].(MalList)
+	if !ok || len(pairs.Values)%2 != 0 {
+		return nil, syntaxError("binding bindings must be an even-sized list, got %v", args[0])
+	}
+
+	saved := t.bindings
+	inner := make(bindings, len(saved)+len(pairs.Values)/2)
+	for k, v := range saved {
+		inner[k] = v
+	}
+	for i := 0; i < len(pairs.Values); i += 2 {
+		sym, ok := pairs.Values[i].(MalSymbol)
+		if !ok {
+			return nil, syntaxError("binding key must be MalSymbol, got %v", pairs.Values[i])
+		}
+		v, err := resolveDynamic(sym, replEnv, env)
+		if err != nil {
+			return nil, err
+		}
+		// values are evaluated with the outer bindings, as in let
+		val, err := eval(t, pairs.Values[i+1], replEnv, env)
+		if err != nil {
+			return nil, err
+		}
+		inner[v] = val
+	}
+
+	t.bindings = inner
+	defer func() {
+		t.bindings = saved
+	}()
+	return evalBody(t, args[1:], replEnv, env)
+}
+
+// DynamicNamespace returns the builtins for dynamic vars, which act on
+// the bindings of the calling thread.
+func DynamicNamespace() Namespace {
+	m := make(map[MalSymbol]MalFunc)
+
+	m[makeSymbol("bound-fn*")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		f, ok := args[0].(MalInvoke)
+		if !ok {
+			return nil, NewTypeError("function", args[0])
+		}
+		captured := t.bindings
+		return makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+			saved := t.bindings
+			t.bindings = captured
+			defer func() {
+				t.bindings = saved
+			}()
+			return f.Invoke(t, args)
+		}), nil
+	})
+
+	return Namespace{M: m}
+}
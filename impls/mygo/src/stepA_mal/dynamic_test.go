@@ -0,0 +1,47 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestConcurrentBindings(t *testing.T) {
+	env := InitialEnv()
+	th := NewThread(env.state)
+	var barrier sync.WaitGroup
+	barrier.Add(2)
+	// wait returns once both goroutines are inside their binding form
+	env.Set("wait", makeFunc(func(*Thread, []MalValue) (MalValue, error) {
+		barrier.Done()
+		barrier.Wait()
+		return nil, nil
+	}))
+	if _, err := rep(th, "(def-dynamic! *x* 0)", env); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"1", "2"}
+	got := make([]string, len(want))
+	errs := make([]error, len(want))
+	var done sync.WaitGroup
+	for i, x := range want {
+		done.Add(1)
+		go func(i int, x string, th *Thread) {
+			defer done.Done()
+			got[i], errs[i] = rep(th, "(binding [*x* "+x+"] (do (wait) *x*))", env)
+		}(i, x, th.Fork())
+	}
+	done.Wait()
+
+	for i := range want {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if got[i] != want[i] {
+			t.Errorf("*x* is %s in goroutine %d, want %s", got[i], i, want[i])
+		}
+	}
+	if x, err := rep(th, "*x*", env); err != nil || x != "0" {
+		t.Errorf("*x* is %s after the binding forms, want 0 (%v)", x, err)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// EDNModuleName is the name of the module of the EDN builtins, which are
+// called as edn/read-string or through an alias.
+const EDNModuleName = "edn"
+
+// EDN data is read by the same reader as code, in a mode that rejects the
+// reader macros of code: quote, syntax quote, deref, metadata, regexes and
+// those of the dispatch table. Reading EDN never evaluates anything: tagged
+// literals are built by the reader functions given for their tags.
+
+// ednOptions are the reader functions of tagged literals, by tag.
+type ednOptions struct {
+	readers   map[string]MalInvoke
+	defaultFn MalInvoke // called with the tag and the form of unknown tags, or nil
+	thread    *Thread   // in which the reader functions are called
+}
+
+// MalInst is an instant, read from and printed as #inst "...".
+type MalInst struct {
+	Time time.Time
+}
+
+func (MalInst) MalValue() {}
+
+// String formats i as RFC 3339 in UTC, to the millisecond unless it is more
+// precise.
+func (i MalInst) String() string {
+	t := i.Time.UTC()
+	layout := "2006-01-02T15:04:05.000"
+	if t.Nanosecond()%int(time.Millisecond) != 0 {
+		layout = "2006-01-02T15:04:05.000000000"
+	}
+	return t.Format(layout) + "-00:00"
+}
+
+// instLayouts are the accepted forms of #inst strings, from the most to
+// the least precise.
+var instLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+func parseInst(s string) (MalInst, error) {
+	for _, layout := range instLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return MalInst{Time: t}, nil
+		}
+	}
+	return MalInst{}, fmt.Errorf("invalid #inst %q", s)
+}
+
+// MalUUID is a UUID, read from and printed as #uuid "...".
+type MalUUID struct {
+	Value string // in lower case
+}
+
+func (MalUUID) MalValue() {}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func parseUUID(s string) (MalUUID, error) {
+	if !uuidPattern.MatchString(s) {
+		return MalUUID{}, fmt.Errorf("invalid #uuid %q", s)
+	}
+	return MalUUID{Value: strings.ToLower(s)}, nil
+}
+
+// isEDN reports whether v prints as EDN, leaving aside the values it
+// contains.
+func isEDN(v MalValue) bool {
+	switch v.(type) {
+	case MalSymbol, MalInt, MalFloat, MalBool, MalString, MalList, *MalLazySeq,
+		*MalMap, *MalSortedMap, *MalSet, *MalSortedSet, MalInst, MalUUID:
+		return true
+	default:
+		return false
+	}
+}
+
+// ednFloat formats f so that it reads back as the same float.
+func ednFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "##NaN"
+	case math.IsInf(f, 1):
+		return "##Inf"
+	case math.IsInf(f, -1):
+		return "##-Inf"
+	default:
+		return floatLiteral(f)
+	}
+}
+
+// readNamespacedMap reads the map of #:ns{...}, whose keyword and symbol
+// keys without a namespace get ns, except those written _/name which get
+// none.
+func (r *Reader) readNamespacedMap(ns string) (MalValue, error) {
+	if ns == "" || strings.HasPrefix(ns, ":") {
+		return nil, fmt.Errorf("invalid namespaced map #:%s", ns)
+	}
+	if peek, err := r.Peek(); err != nil || peek != "{" {
+		return nil, fmt.Errorf("expected a map after #:%s", ns)
+	}
+	form, err := r.ReadList(ListTypeMap)
+	if err != nil {
+		return nil, err
+	}
+	qualify := func(name string) string {
+		if strings.HasPrefix(name, "_/") {
+			return name[2:]
+		}
+		if strings.Contains(name, "/") {
+			return name
+		}
+		return ns + "/" + name
+	}
+	m := NewMap()
+	for _, kv := range form.(*MalMap).Iter() {
+		key := kv.Key
+		switch k := key.(type) {
+		case MalString:
+			if name, err := k.AsKeyword(); err == nil {
+				key = NewKeyword(qualify(name))
+			}
+		case MalSymbol:
+			key = MalSymbol{Value: qualify(k.Value)}
+		}
+		if _, ok := m.Get(key); ok && r.edn != nil {
+			return nil, fmt.Errorf("duplicate key %s in map", PrStr(key, true))
+		}
+		m.Set(key, kv.Value)
+	}
+	return m, nil
+}
+
+// checkDistinct returns an error if the keys of the map or the elements
+// of the set read as values are not distinct.
+func checkDistinct(typ listType, values []MalValue) error {
+	switch typ {
+	case ListTypeMap:
+		keys := []MalValue{}
+		for i := 0; i < len(values); i += 2 {
+			keys = append(keys, values[i])
+		}
+		if k, ok := duplicate(keys); ok {
+			return fmt.Errorf("duplicate key %s in map", PrStr(k, true))
+		}
+	case ListTypeSet:
+		if x, ok := duplicate(values); ok {
+			return fmt.Errorf("duplicate element %s in set", PrStr(x, true))
+		}
+	}
+	return nil
+}
+
+// duplicate returns the first of xs equal to an earlier one.
+func duplicate(xs []MalValue) (MalValue, bool) {
+	for i := range xs {
+		for _, y := range xs[:i] {
+			if malEq(xs[i], y) {
+				return xs[i], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// readTagged reads the form tagged with tag, and returns what the reader
+// function of tag makes of it.
+func (r *Reader) readTagged(tag string) (MalValue, error) {
+	form, err := r.ReadForm()
+	if err != nil {
+		return nil, err
+	}
+	if r.edn != nil {
+		if f, ok := r.edn.readers[tag]; ok {
+			return f.Invoke(r.edn.thread, []MalValue{form})
+		}
+	}
+	switch tag {
+	case "inst", "uuid":
+		s, ok := form.(MalString)
+		if !ok || s.IsKeyword() {
+			return nil, fmt.Errorf("#%s expects a string", tag)
+		}
+		if tag == "inst" {
+			return parseInst(s.Value)
+		}
+		return parseUUID(s.Value)
+	}
+	if r.edn != nil && r.edn.defaultFn != nil {
+		return r.edn.defaultFn.Invoke(r.edn.thread, []MalValue{MalSymbol{Value: tag}, form})
+	}
+	return nil, fmt.Errorf("no reader function for tag #%s", tag)
+}
+
+// ReadEDN reads the first EDN value of input, or nil if there is none.
+func ReadEDN(input string, opts *ednOptions) (MalValue, error) {
+	r := NewReader(Tokenize(input))
+	r.edn = opts
+	form, _, err := r.readNext()
+	if err != nil {
+		return nil, readError(err)
+	}
+	return form, nil
+}
+
+// addEDNReaders adds the reader functions of the map readers, keyed by
+// symbols, to opts.
+func addEDNReaders(opts *ednOptions, readers MalValue) error {
+	if readers == nil {
+		return nil
+	}
+	entries, ok := mapEntries(readers)
+	if !ok {
+		return NewTypeError("map", readers)
+	}
+	for _, e := range entries {
+		tag, ok := e.Key.(MalSymbol)
+		if !ok {
+			return NewTypeError("symbol", e.Key)
+		}
+		f, err := funcArg(e.Value)
+		if err != nil {
+			return err
+		}
+		opts.readers[tag.Value] = f
+	}
+	return nil
+}
+
+// EDNNamespace returns the builtins of the edn module. The reader functions
+// of *data-readers* apply to every read, and are overridden by those given
+// as :readers.
+func EDNNamespace(env *Env) Namespace {
+	m := make(map[MalSymbol]MalFunc)
+
+	m[makeSymbol("read-string")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 && len(args) != 2 {
+			return nil, ErrWrongFuncNArgs
+		}
+		opts := &ednOptions{readers: map[string]MalInvoke{}, thread: t}
+		if v, ok := t.get(t.CurrentEnv(), "*data-readers*"); ok {
+			if err := addEDNReaders(opts, v); err != nil {
+				return nil, err
+			}
+		}
+		if len(args) == 2 {
+			if args[0] != nil && !isMap(args[0]) {
+				return nil, NewTypeError("map", args[0])
+			}
+			if readers, ok := getOf(args[0], NewKeyword("readers")); ok {
+				if err := addEDNReaders(opts, readers); err != nil {
+					return nil, err
+				}
+			}
+			if f, ok := getOf(args[0], NewKeyword("default")); ok && f != nil {
+				var err error
+				if opts.defaultFn, err = funcArg(f); err != nil {
+					return nil, err
+				}
+			}
+		}
+		s, err := stringArg(args[len(args)-1])
+		if err != nil {
+			return nil, err
+		}
+		return ReadEDN(s, opts)
+	})
+	m[makeSymbol("write-string")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		opts := DefaultPrintOptions(true)
+		opts.EDN = true
+		var sb strings.Builder
+		if err := PrWrite(&sb, args[0], opts); err != nil {
+			return nil, err
+		}
+		return NewString(sb.String()), nil
+	})
+
+	return Namespace{M: m}
+}
@@ -3,8 +3,13 @@ package main
 import "fmt"
 
 type Env struct {
-	M     map[string]MalValue
-	Outer *Env
+	M      map[string]MalValue
+	Outer  *Env
+	state  *EvalState // set on the core and module environments only
+	module *Module    // set on the core and module environments only
+
+	dynamic map[string]bool    // names of dynamic vars defined in the environment
+	meta    map[string]*MalMap // metadata of the definitions, such as docstrings
 }
 
 func NewEnv(outer *Env, binds []string, exprs []MalValue) (*Env, error) {
@@ -19,13 +24,13 @@ func NewEnv(outer *Env, binds []string, exprs []MalValue) (*Env, error) {
 			break
 		}
 		if i >= len(exprs) {
-			return nil, fmt.Errorf("expected %d expressions, got %d", len(binds), len(exprs))
+			return nil, fmt.Errorf("%w: expected %d expressions, got %d", ErrWrongFuncNArgs, len(binds), len(exprs))
 		}
 		env.Set(bind, exprs[i])
 	}
 
 	if !useRest && (len(binds) != len(exprs)) {
-		return nil, fmt.Errorf("expected %d binds, got %d", len(binds), len(exprs))
+		return nil, fmt.Errorf("%w: expected %d binds, got %d", ErrWrongFuncNArgs, len(binds), len(exprs))
 	}
 
 	return env, nil
@@ -45,6 +50,8 @@ func (e *Env) Find(key string) (*Env, bool) {
 	return e.Outer.Find(key)
 }
 
+// Get returns the value of key in e, which for a dynamic var is its root
+// value, as bound by no thread.
 func (e *Env) Get(key string) (MalValue, bool) {
 	env, ok := e.Find(key)
 	if !ok {
@@ -1,26 +1,173 @@
 package main
 
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+)
+
+// DebugPanics makes errors recovered from Go panics carry the Go stack.
+// It is enabled by setting the MAL_DEBUG environment variable.
+var DebugPanics = os.Getenv("MAL_DEBUG") != ""
+
+// ErrorKind classifies a MalError. Kinds are visible to mal code as
+// keywords, and Go code can test for them with errors.Is.
+type ErrorKind string
+
+const (
+	ErrKindError             ErrorKind = "error"
+	ErrKindThrow             ErrorKind = "throw"
+	ErrKindExInfo            ErrorKind = "ex-info"
+	ErrKindArity             ErrorKind = "arity-error"
+	ErrKindType              ErrorKind = "type-error"
+	ErrKindUnbound           ErrorKind = "unbound-symbol"
+	ErrKindIndex             ErrorKind = "index-out-of-bounds"
+	ErrKindSyntax            ErrorKind = "syntax-error"
+	ErrKindRead              ErrorKind = "read-error"
+	ErrKindInternal          ErrorKind = "internal-error"
+	ErrKindInterrupted       ErrorKind = "interrupted"
+	ErrKindControl           ErrorKind = "control-error"
+	ErrKindStackOverflow     ErrorKind = "stack-overflow"
+	ErrKindNamespaceNotFound ErrorKind = "namespace-not-found"
+	ErrKindCircularRequire   ErrorKind = "circular-require"
+)
+
+func (k ErrorKind) Error() string {
+	return string(k)
+}
+
+func (k ErrorKind) Keyword() MalString {
+	return NewKeyword(string(k))
+}
+
 type MalError struct {
+	kind    ErrorKind
 	message MalValue
-	value   MalValue
+	value   MalValue // the value bound by catch*
+	data    MalValue // map given to ex-info, nil otherwise
+	cause   error
+	stack   string // Go stack of a recovered panic, if DebugPanics is set
 }
 
+func (*MalError) MalValue() {}
+
 func NewError(message string) *MalError {
-	return &MalError{message: NewString(message), value: NewString(message)}
+	return NewKindError(ErrKindError, message)
+}
+
+func NewKindError(kind ErrorKind, message string) *MalError {
+	return &MalError{kind: kind, message: NewString(message), value: NewString(message)}
+}
+
+func NewTypeError(expected string, got MalValue) *MalError {
+	return NewKindError(ErrKindType, fmt.Sprintf("expected %s, got %s", expected, PrStr(got, true)))
+}
+
+// syntaxError reports a malformed special form. MalValue arguments
+// are formatted as with pr-str.
+func syntaxError(format string, args ...interface{}) *MalError {
+	for i, arg := range args {
+		if v, ok := arg.(MalValue); ok {
+			args[i] = PrStr(v, true)
+		}
+	}
+	return NewKindError(ErrKindSyntax, fmt.Sprintf(format, args...))
 }
 
+// NewErrorFromError converts a Go error into a mal error. Errors that
+// wrap a MalError keep its kind and data.
 func NewErrorFromError(err error) *MalError {
-	return &MalError{message: NewString(err.Error()), value: NewString(err.Error())}
+	var malErr *MalError
+	if !errors.As(err, &malErr) {
+		return &MalError{kind: ErrKindError, message: NewString(err.Error()), value: NewString(err.Error()), cause: err}
+	}
+	if malErr == err {
+		return malErr
+	}
+
+	value := malErr.value
+	if _, ok := value.(MalString); ok {
+		value = NewString(err.Error())
+	}
+	return &MalError{kind: malErr.kind, message: NewString(err.Error()), value: value, data: malErr.data, cause: err}
 }
 
+// NewErrorFromValue creates the error raised by (throw value).
+// Throwing an error value, such as one made by ex-info, raises it as is,
+// and a thrown keyword is its own kind.
 func NewErrorFromValue(message MalValue) *MalError {
-	return &MalError{message: message, value: message}
+	if err, ok := message.(*MalError); ok {
+		return err
+	}
+	kind := ErrKindThrow
+	if kw, ok := message.(MalString); ok {
+		if name, err := kw.AsKeyword(); err == nil {
+			kind = ErrorKind(name)
+		}
+	}
+	return &MalError{kind: kind, message: message, value: message}
+}
+
+// NewExInfo creates the error value returned by ex-info. A :kind keyword
+// in data becomes the kind of the error.
+func NewExInfo(message string, data MalValue, cause error) *MalError {
+	kind := ErrKindExInfo
+	if m, ok := data.(*MalMap); ok {
+		if k, ok := m.Get(NewKeyword("kind")); ok {
+			if k, ok := k.(MalString); ok {
+				if name, err := k.AsKeyword(); err == nil {
+					kind = ErrorKind(name)
+				}
+			}
+		}
+	}
+	e := &MalError{kind: kind, message: NewString(message), data: data, cause: cause}
+	e.value = e
+	return e
+}
+
+// NewErrorFromPanic converts a value recovered from a Go panic into a mal error.
+func NewErrorFromPanic(r interface{}) *MalError {
+	if err, ok := r.(*MalError); ok {
+		return err
+	}
+	e := NewKindError(ErrKindInternal, fmt.Sprintf("internal error: %v", r))
+	if DebugPanics {
+		e.stack = string(debug.Stack())
+	}
+	return e
+}
+
+// recoverError turns a panic in the calling function into an error
+// returned through err. It must be called with defer.
+func recoverError(err *error) {
+	if r := recover(); r != nil {
+		*err = NewErrorFromPanic(r)
+	}
 }
 
 func (e *MalError) Error() string {
+	if e.stack != "" {
+		return PrStr(e.message, false) + "\n" + e.stack
+	}
 	return PrStr(e.message, false)
 }
 
+// Is reports whether e is of the given ErrorKind.
+func (e *MalError) Is(target error) bool {
+	kind, ok := target.(ErrorKind)
+	return ok && kind == e.kind
+}
+
+func (e *MalError) Unwrap() error {
+	return e.cause
+}
+
+func (e *MalError) Kind() ErrorKind {
+	return e.kind
+}
+
 func (e *MalError) Message() MalValue {
 	return e.message
 }
@@ -28,3 +175,85 @@ func (e *MalError) Message() MalValue {
 func (e *MalError) Value() MalValue {
 	return e.value
 }
+
+func (e *MalError) Data() MalValue {
+	return e.data
+}
+
+// Cause returns the mal value of the error wrapped by e, or nil.
+func (e *MalError) Cause() MalValue {
+	if e.cause == nil {
+		return nil
+	}
+	return NewErrorFromError(e.cause).Value()
+}
+
+// caughtError returns the error v stands for: v itself if it is an error,
+// or else the innermost error handled by a catch* clause that bound v
+// itself. The message of an error raised by a builtin is bound as a
+// string, which keeps its kind available to the catch* body this way.
+func (t *Thread) caughtError(v MalValue) (*MalError, bool) {
+	if e, ok := v.(*MalError); ok {
+		return e, true
+	}
+	for i := len(t.caught) - 1; i >= 0; i-- {
+		if identical(t.caught[i].Value(), v) {
+			return t.caught[i], true
+		}
+	}
+	return nil, false
+}
+
+// identical reports whether a and b are the same value: the same map,
+// atom or other reference, or the same list rather than an equal one.
+// Strings, numbers and the other immutable values have no identity, and
+// are identical when they are equal.
+func identical(a, b MalValue) bool {
+	switch a := a.(type) {
+	case *MalMap, *MalSortedMap, *MalSet, *MalSortedSet, *MalAtom, *MalLazySeq, *MalError, *MalRegex, *MalReduced:
+		return a == b
+	case MalList:
+		b, ok := b.(MalList)
+		if !ok || len(a.Values) != len(b.Values) || a.IsVector() != b.IsVector() {
+			return false
+		}
+		return len(a.Values) == 0 || &a.Values[0] == &b.Values[0]
+	case MalFunc, MalTcoFunc:
+		return false
+	default:
+		return malEq(a, b)
+	}
+}
+
+// ErrorNamespace returns the accessors of error values, which also accept
+// the value bound by catch* for the error the calling thread is handling.
+func ErrorNamespace() Namespace {
+	m := make(map[MalSymbol]MalFunc)
+
+	accessor := func(f func(*MalError) MalValue) MalFunc {
+		return makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+			if len(args) != 1 {
+				return nil, ErrWrongFuncNArgs
+			}
+			e, ok := t.caughtError(args[0])
+			if !ok {
+				return nil, nil
+			}
+			return f(e), nil
+		})
+	}
+	m[makeSymbol("ex-message")] = accessor(func(e *MalError) MalValue {
+		return e.Message()
+	})
+	m[makeSymbol("ex-data")] = accessor(func(e *MalError) MalValue {
+		return e.Data()
+	})
+	m[makeSymbol("ex-cause")] = accessor(func(e *MalError) MalValue {
+		return e.Cause()
+	})
+	m[makeSymbol("ex-kind")] = accessor(func(e *MalError) MalValue {
+		return e.Kind().Keyword()
+	})
+
+	return Namespace{M: m}
+}
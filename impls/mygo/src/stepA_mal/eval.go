@@ -2,52 +2,142 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
 )
 
+var interrupted atomic.Bool
+
+// Interrupt cancels the evaluation in progress, which fails with an
+// :interrupted error once it reaches the next evaluation step.
+func Interrupt() {
+	interrupted.Store(true)
+}
+
+// resetInterrupt clears a pending interrupt and reports whether there was one.
+func resetInterrupt() bool {
+	return interrupted.Swap(false)
+}
+
+// interruptOnSignal makes SIGINT interrupt the evaluation in progress
+// rather than exit, until the returned function is called. A second SIGINT
+// before the evaluation notices the first one, as when a builtin is blocked
+// reading input, exits as usual.
+func interruptOnSignal() (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-signals:
+				if interrupted.Load() {
+					os.Exit(130)
+				}
+				Interrupt()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+func checkInterrupt() error {
+	if interrupted.Load() {
+		return NewKindError(ErrKindInterrupted, "interrupted")
+	}
+	return nil
+}
+
 func InitialEnv() *Env {
 	env, err := NewEnv(nil, nil, nil)
 	if err != nil {
 		panic("unreachable")
 	}
 
-	ns := DefaultNamespace()
-	for k, v := range ns.M {
-		env.Set(k.Value, v)
+	env.state = NewEvalState()
+	env.state.core = env
+	env.module = &Module{Name: CoreModuleName, Env: env, aliases: make(map[string]string), loaded: true}
+	env.state.modules[CoreModuleName] = env.module
+
+	for _, ns := range []Namespace{DefaultNamespace(), ErrorNamespace(), PrintNamespace(env), ConditionNamespace(), ModuleNamespace(env), DynamicNamespace(), IntrospectionNamespace(env), LazyNamespace(), SeqNamespace(), TransducerNamespace(), RegexNamespace(), FormatNamespace(), SortedNamespace()} {
+		for k, v := range ns.M {
+			v.Name = k.Value
+			env.Set(k.Value, v)
+			env.setVarMeta(k.Value, builtinMeta(CoreModuleName, k.Value))
+		}
 	}
+	env.state.defineModule(StringModuleName, StringNamespace())
+	env.state.defineModule(MathModuleName, MathNamespace(env))
+	env.state.defineModule(JSONModuleName, JSONNamespace())
+	env.state.defineModule(EDNModuleName, EDNNamespace(env))
 
 	return env
 }
 
-func EvalAst(ast MalValue, replEnv *Env, env *Env) (MalValue, error) {
+func EvalAst(t *Thread, ast MalValue, replEnv *Env, env *Env) (MalValue, error) {
 	switch a := ast.(type) {
 	case MalSymbol:
-		v, ok := env.Get(a.Value)
+		v, ok := lookupSymbol(t, a.Value, replEnv, env)
 		if !ok {
-			return nil, fmt.Errorf("'%s' not found", a.Value)
+			return nil, NewKindError(ErrKindUnbound, fmt.Sprintf("'%s' not found", a.Value))
+		}
+		if w, ok := v.(MalWithMeta); ok && a.Meta != nil {
+			// ^meta sym reads as sym with metadata, and evaluates as
+			// (with-meta sym meta) would
+			return w.WithMeta(a.Meta), nil
 		}
 		return v, nil
 	case MalList:
 		vals := make([]MalValue, len(a.Values))
 		for i, v := range a.Values {
-			val, err := eval(v, replEnv, env)
+			val, err := eval(t, v, replEnv, env)
 			if err != nil {
 				return nil, err
 			}
 			vals[i] = val
 		}
-		return MalList{Values: vals, Vector: a.Vector}, nil
+		return MalList{Values: vals, Vector: a.Vector, Meta: a.Meta}, nil
 	case *MalMap:
 		kvs := make([]MalValue, 0)
 		for _, kv := range a.Iter() {
 			kvs = append(kvs, kv.Key)
 
-			v, err := eval(kv.Value, replEnv, env)
+			v, err := eval(t, kv.Value, replEnv, env)
 			if err != nil {
 				return nil, err
 			}
 			kvs = append(kvs, v)
 		}
-		return NewMapFromList(kvs)
+		m, err := NewMapFromList(kvs)
+		if err != nil {
+			return nil, err
+		}
+		m.SetMeta(a.GetMeta())
+		return m, nil
+	case *MalSet:
+		items := a.items()
+		for i, v := range items {
+			var err error
+			if items[i], err = eval(t, v, replEnv, env); err != nil {
+				return nil, err
+			}
+		}
+		return (&MalSet{meta: a.meta}).Conj(items), nil
+	case *MalSortedSet:
+		items := sortedItems(a)
+		for i, v := range items {
+			var err error
+			if items[i], err = eval(t, v, replEnv, env); err != nil {
+				return nil, err
+			}
+		}
+		return (&MalSortedSet{tree: sortedTree{cmp: a.tree.cmp}, meta: a.meta}).Conj(items)
 	default:
 		return ast, nil
 	}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// showFn converts a value to a string as str, or as pr-str if readably.
+type showFn func(v MalValue, readably bool) (string, error)
+
+// formatArgs hands out the arguments of a format string in order.
+type formatArgs struct {
+	fn     string
+	values []MalValue
+	pos    int
+}
+
+func (a *formatArgs) next(directive string) (MalValue, error) {
+	if a.pos >= len(a.values) {
+		return nil, NewKindError(ErrKindArity, fmt.Sprintf("%s: no argument left for %s", a.fn, directive))
+	}
+	a.pos++
+	return a.values[a.pos-1], nil
+}
+
+func (a *formatArgs) done() bool {
+	return a.pos >= len(a.values)
+}
+
+func formatTypeError(fn string, directive string, expected string, got MalValue) *MalError {
+	return NewKindError(ErrKindType, fmt.Sprintf("%s: %s expects %s, got %s", fn, directive, expected, PrStr(got, true)))
+}
+
+// sprintf formats args by the directives of format, which follow Go's
+// fmt package: %s and %v print a value as str and pr-str do, %d, %x, %X,
+// %o and %b an integer, %f, %e and %g a number, %c a character and %t a
+// boolean. Flags, width and precision are passed on to fmt.
+func sprintf(format string, args []MalValue, show showFn) (string, error) {
+	a := &formatArgs{fn: "format", values: args}
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			sb.WriteByte(format[i])
+			continue
+		}
+		start := i
+		i++
+		for i < len(format) && strings.IndexByte("-+# 0.123456789", format[i]) >= 0 {
+			i++
+		}
+		if i >= len(format) {
+			return "", NewError(fmt.Sprintf("format: incomplete directive %s", format[start:]))
+		}
+		verb, size := utf8.DecodeRuneInString(format[i:])
+		i += size - 1
+		spec := format[start+1 : i+1-size]
+		directive := format[start : i+1]
+
+		switch verb {
+		case '%':
+			sb.WriteByte('%')
+			continue
+		case 'n':
+			sb.WriteByte('\n')
+			continue
+		}
+		v, err := a.next(directive)
+		if err != nil {
+			return "", err
+		}
+		var goArg interface{}
+		goVerb := verb
+		switch verb {
+		case 's', 'v':
+			s, err := show(v, verb == 'v')
+			if err != nil {
+				return "", err
+			}
+			goArg, goVerb = s, 's'
+		case 'd', 'x', 'X', 'o', 'b':
+			n, ok := v.(MalInt)
+			if !ok {
+				return "", formatTypeError("format", directive, "an integer", v)
+			}
+			goArg = n.Value
+		case 'f', 'F', 'e', 'E', 'g', 'G':
+			switch n := v.(type) {
+			case MalInt:
+				goArg = float64(n.Value)
+			case MalFloat:
+				goArg = n.Value
+			default:
+				return "", formatTypeError("format", directive, "a number", v)
+			}
+		case 'c':
+			switch c := v.(type) {
+			case MalInt:
+				goArg = rune(c.Value)
+			case MalString:
+				r, size := utf8.DecodeRuneInString(c.Value)
+				if c.IsKeyword() || size == 0 || size != len(c.Value) {
+					return "", formatTypeError("format", directive, "a character", v)
+				}
+				goArg = r
+			default:
+				return "", formatTypeError("format", directive, "a character", v)
+			}
+		case 't':
+			b, ok := v.(MalBool)
+			if !ok {
+				return "", formatTypeError("format", directive, "a boolean", v)
+			}
+			goArg = b.Value
+		default:
+			return "", NewError(fmt.Sprintf("format: unknown directive %s", directive))
+		}
+		fmt.Fprintf(&sb, "%"+spec+string(goVerb), goArg)
+	}
+	if !a.done() {
+		return "", NewKindError(ErrKindArity, fmt.Sprintf("format: %d arguments given, but the format uses %d", len(args), a.pos))
+	}
+	return sb.String(), nil
+}
+
+// clDirective is a ~ directive of cl-format. The body of ~{ is the
+// directives up to the matching ~}.
+type clDirective struct {
+	char   rune
+	params []int
+	at     bool
+	body   []interface{} // string or *clDirective
+	source string
+}
+
+// parseCl parses format from i up to the directive ~end, or to the end
+// of format if end is 0. It returns the parsed nodes and the index after
+// them.
+func parseCl(format string, i int, end rune) ([]interface{}, int, error) {
+	nodes := []interface{}{}
+	var text strings.Builder
+	for i < len(format) {
+		c, size := utf8.DecodeRuneInString(format[i:])
+		if c != '~' {
+			text.WriteRune(c)
+			i += size
+			continue
+		}
+		start := i
+		i++
+		d := &clDirective{}
+		for {
+			j := i
+			for j < len(format) && format[j] >= '0' && format[j] <= '9' {
+				j++
+			}
+			if j > i {
+				n, _ := strconv.Atoi(format[i:j])
+				d.params = append(d.params, n)
+				i = j
+			}
+			if i < len(format) && format[i] == ',' {
+				i++
+				continue
+			}
+			break
+		}
+		if i < len(format) && format[i] == '@' {
+			d.at = true
+			i++
+		}
+		if i >= len(format) {
+			return nil, 0, NewError(fmt.Sprintf("cl-format: incomplete directive %s", format[start:]))
+		}
+		d.char, size = utf8.DecodeRuneInString(format[i:])
+		i += size
+		d.source = format[start:i]
+		d.char = []rune(strings.ToLower(string(d.char)))[0]
+
+		switch d.char {
+		case '~':
+			text.WriteRune('~')
+			continue
+		case '%':
+			text.WriteRune('\n')
+			continue
+		}
+		if text.Len() > 0 {
+			nodes = append(nodes, text.String())
+			text.Reset()
+		}
+		switch d.char {
+		case end:
+			return nodes, i, nil
+		case '}':
+			return nil, 0, NewError(fmt.Sprintf("cl-format: unmatched %s", d.source))
+		case '{':
+			body, next, err := parseCl(format, i, '}')
+			if err != nil {
+				return nil, 0, err
+			}
+			d.body, i = body, next
+		case 'a', 's', 'd', '^':
+		default:
+			return nil, 0, NewError(fmt.Sprintf("cl-format: unsupported directive %s", d.source))
+		}
+		nodes = append(nodes, d)
+	}
+	if end != 0 {
+		return nil, 0, NewError(fmt.Sprintf("cl-format: missing ~%c", end))
+	}
+	if text.Len() > 0 {
+		nodes = append(nodes, text.String())
+	}
+	return nodes, i, nil
+}
+
+// runCl writes the output of nodes for args to sb. It reports whether
+// ~^ ended the output because args were exhausted.
+func runCl(sb *strings.Builder, nodes []interface{}, args *formatArgs, show showFn) (bool, error) {
+	for _, node := range nodes {
+		d, ok := node.(*clDirective)
+		if !ok {
+			sb.WriteString(node.(string))
+			continue
+		}
+		switch d.char {
+		case '^':
+			if args.done() {
+				return true, nil
+			}
+		case 'a', 's', 'd':
+			v, err := args.next(d.source)
+			if err != nil {
+				return false, err
+			}
+			if _, ok := v.(MalInt); d.char == 'd' && !ok {
+				return false, formatTypeError("cl-format", d.source, "an integer", v)
+			}
+			s, err := show(v, d.char == 's')
+			if err != nil {
+				return false, err
+			}
+			// ~mincolA pads on the right, and ~mincol@A on the left
+			if len(d.params) > 0 {
+				if padding := d.params[0] - utf8.RuneCountInString(s); padding > 0 {
+					if d.at {
+						s = strings.Repeat(" ", padding) + s
+					} else {
+						s += strings.Repeat(" ", padding)
+					}
+				}
+			}
+			sb.WriteString(s)
+		case '{':
+			// ~{ iterates over the elements of a list argument, and ~@{
+			// over the remaining arguments
+			iter := args
+			if !d.at {
+				v, err := args.next(d.source)
+				if err != nil {
+					return false, err
+				}
+				values, err := seqValues(v)
+				if err != nil {
+					return false, err
+				}
+				iter = &formatArgs{fn: args.fn, values: values}
+			}
+			for !iter.done() {
+				pos := iter.pos
+				stop, err := runCl(sb, d.body, iter, show)
+				if err != nil {
+					return false, err
+				}
+				if stop || iter.pos == pos {
+					break
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+// clFormat formats args by the cl-format directives of format: ~a and ~s
+// print a value as str and pr-str do, with an optional minimum width, ~d
+// an integer, ~% a newline and ~~ a tilde. ~{...~} repeats its body for
+// the elements of a list, and ~^ leaves it before the last one.
+func clFormat(format string, args []MalValue, show showFn) (string, error) {
+	nodes, _, err := parseCl(format, 0, 0)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if _, err := runCl(&sb, nodes, &formatArgs{fn: "cl-format", values: args}, show); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// FormatNamespace returns the formatting builtins. Values are formatted in
+// full, as by str, whatever *print-length* and *print-level*.
+func FormatNamespace() Namespace {
+	m := make(map[MalSymbol]MalFunc)
+
+	show := func(v MalValue, readably bool) (string, error) {
+		var sb strings.Builder
+		err := PrWrite(&sb, v, DefaultPrintOptions(readably))
+		return sb.String(), err
+	}
+	formatFn := func(args []MalValue) (string, error) {
+		if len(args) < 1 {
+			return "", ErrWrongFuncNArgs
+		}
+		format, err := stringArg(args[0])
+		if err != nil {
+			return "", err
+		}
+		return sprintf(format, args[1:], show)
+	}
+
+	m[makeSymbol("format")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		s, err := formatFn(args)
+		if err != nil {
+			return nil, err
+		}
+		return NewString(s), nil
+	})
+	m[makeSymbol("printf")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		s, err := formatFn(args)
+		if err != nil {
+			return nil, err
+		}
+		return nil, printStdout([]MalValue{NewString(s)}, "", "", DefaultPrintOptions(false))
+	})
+	m[makeSymbol("cl-format")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) < 2 {
+			return nil, ErrWrongFuncNArgs
+		}
+		format, err := stringArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		s, err := clFormat(format, args[2:], show)
+		if err != nil {
+			return nil, err
+		}
+		switch dest := args[0].(type) {
+		case nil:
+			return NewString(s), nil
+		case MalBool:
+			if dest.Value {
+				return nil, printStdout([]MalValue{NewString(s)}, "", "", DefaultPrintOptions(false))
+			}
+			return NewString(s), nil
+		default:
+			return nil, NewTypeError("nil or true", args[0])
+		}
+	})
+
+	return Namespace{M: m}
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// JSONModuleName is the name of the module of the JSON builtins, which
+// are called as json/read-str or through an alias.
+const JSONModuleName = "json"
+
+// JSON values are read as follows: null is nil, true and false are
+// booleans, strings are strings, arrays are vectors and objects are maps
+// keeping the order of their keys. Numbers without a fraction or an
+// exponent are integers, and other numbers are floats. Integers beyond
+// the range of integers are a read-error rather than an inexact float.
+//
+// Values are written back the same way. Keywords and symbols are written
+// as strings of their names, and lists, lazy sequences and sets as
+// arrays. Floats are written with the fewest digits that read back as the
+// same float, and always with a fraction or an exponent so that they stay
+// floats.
+
+// jsonError converts an error of the JSON decoder into a read-error.
+func jsonError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return NewKindError(ErrKindRead, "json: unexpected end of input")
+	}
+	var mal *MalError
+	if errors.As(err, &mal) {
+		return err
+	}
+	var syntax *json.SyntaxError
+	if errors.As(err, &syntax) {
+		if syntax.Error() == "unexpected end of JSON input" {
+			return NewKindError(ErrKindRead, "json: unexpected end of input")
+		}
+		return NewKindError(ErrKindRead, fmt.Sprintf("json: %s at offset %d", syntax, syntax.Offset))
+	}
+	return NewKindError(ErrKindRead, "json: "+err.Error())
+}
+
+// jsonDecoder reads the successive JSON values of a stream.
+type jsonDecoder struct {
+	dec    *json.Decoder
+	keyFn  MalInvoke // applied to the keys of objects, or nil
+	thread *Thread   // in which keyFn is called
+}
+
+func newJSONDecoder(r io.Reader, keyFn MalInvoke, t *Thread) *jsonDecoder {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return &jsonDecoder{dec: dec, keyFn: keyFn, thread: t}
+}
+
+// next reads the next value of the stream, and reports false at its end.
+func (d *jsonDecoder) next() (MalValue, bool, error) {
+	tok, err := d.dec.Token()
+	if err == io.EOF {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, jsonError(err)
+	}
+	v, err := d.value(tok)
+	if err != nil {
+		return nil, false, jsonError(err)
+	}
+	return v, true, nil
+}
+
+// value reads the value starting with tok.
+func (d *jsonDecoder) value(tok json.Token) (MalValue, error) {
+	switch t := tok.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		return NewBool(t), nil
+	case string:
+		return NewString(t), nil
+	case json.Number:
+		return jsonNumber(string(t))
+	case json.Delim:
+		if t == '[' {
+			return d.array()
+		}
+		return d.object()
+	default:
+		panic("unreachable")
+	}
+}
+
+func (d *jsonDecoder) array() (MalValue, error) {
+	values := []MalValue{}
+	for d.dec.More() {
+		tok, err := d.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value(tok)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	if _, err := d.dec.Token(); err != nil {
+		return nil, err
+	}
+	return NewVector(values), nil
+}
+
+func (d *jsonDecoder) object() (MalValue, error) {
+	m := NewMap()
+	for d.dec.More() {
+		tok, err := d.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var key MalValue = NewString(tok.(string))
+		if d.keyFn != nil {
+			if key, err = d.keyFn.Invoke(d.thread, []MalValue{key}); err != nil {
+				return nil, err
+			}
+		}
+		if tok, err = d.dec.Token(); err != nil {
+			return nil, err
+		}
+		v, err := d.value(tok)
+		if err != nil {
+			return nil, err
+		}
+		m.Set(key, v)
+	}
+	if _, err := d.dec.Token(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// seq returns the lazy sequence of the values left in the stream. done is
+// called when the stream is exhausted or fails.
+func (d *jsonDecoder) seq() *MalLazySeq {
+	return NewLazySeq(func() (MalValue, error) {
+		v, ok, err := d.next()
+		if err != nil || !ok {
+			return nil, err
+		}
+		return newSeqCell(v, d.seq()), nil
+	})
+}
+
+// jsonNumber converts the JSON number s.
+func jsonNumber(s string) (MalValue, error) {
+	if !strings.ContainsAny(s, ".eE") {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, NewKindError(ErrKindRead, fmt.Sprintf("json: integer out of range: %s", s))
+		}
+		return MalInt{Value: n}, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, NewKindError(ErrKindRead, fmt.Sprintf("json: number out of range: %s", s))
+	}
+	return NewFloat(f), nil
+}
+
+// jsonFloat formats f as a JSON number that reads back as the same float.
+func jsonFloat(f float64) (string, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", NewKindError(ErrKindType, fmt.Sprintf("json: cannot write %v", f))
+	}
+	return floatLiteral(f), nil
+}
+
+// jsonWriter writes values as JSON, indented by indent per level unless
+// indent is empty.
+type jsonWriter struct {
+	sb     strings.Builder
+	indent string
+	depth  int
+}
+
+func (w *jsonWriter) newline() {
+	if w.indent != "" {
+		w.sb.WriteByte('\n')
+		w.sb.WriteString(strings.Repeat(w.indent, w.depth))
+	}
+}
+
+func (w *jsonWriter) writeString(s string) {
+	w.sb.WriteByte('"')
+	for _, c := range s {
+		switch c {
+		case '"':
+			w.sb.WriteString(`\"`)
+		case '\\':
+			w.sb.WriteString(`\\`)
+		case '\n':
+			w.sb.WriteString(`\n`)
+		case '\r':
+			w.sb.WriteString(`\r`)
+		case '\t':
+			w.sb.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				fmt.Fprintf(&w.sb, `\u%04x`, c)
+			} else {
+				w.sb.WriteRune(c)
+			}
+		}
+	}
+	w.sb.WriteByte('"')
+}
+
+// key returns the name of a key of an object: a string, a keyword, a
+// symbol or a number.
+func (w *jsonWriter) key(k MalValue) (string, error) {
+	switch k := k.(type) {
+	case MalString:
+		if name, err := k.AsKeyword(); err == nil {
+			return name, nil
+		}
+		return k.Value, nil
+	case MalSymbol:
+		return k.Value, nil
+	case MalInt:
+		return strconv.FormatInt(k.Value, 10), nil
+	case MalFloat:
+		return jsonFloat(k.Value)
+	default:
+		return "", NewTypeError("JSON object key", k)
+	}
+}
+
+func (w *jsonWriter) write(v MalValue) error {
+	switch v := v.(type) {
+	case nil:
+		w.sb.WriteString("null")
+	case MalBool:
+		w.sb.WriteString(strconv.FormatBool(v.Value))
+	case MalInt:
+		w.sb.WriteString(strconv.FormatInt(v.Value, 10))
+	case MalFloat:
+		s, err := jsonFloat(v.Value)
+		if err != nil {
+			return err
+		}
+		w.sb.WriteString(s)
+	case MalString, MalSymbol:
+		k, _ := w.key(v)
+		w.writeString(k)
+	case *MalMap, *MalSortedMap:
+		entries, _ := mapEntries(v)
+		return w.block('{', len(entries), '}', func(i int) error {
+			k, err := w.key(entries[i].Key)
+			if err != nil {
+				return err
+			}
+			w.writeString(k)
+			w.sb.WriteByte(':')
+			if w.indent != "" {
+				w.sb.WriteByte(' ')
+			}
+			return w.write(entries[i].Value)
+		})
+	case MalList, *MalLazySeq, *MalSet, *MalSortedSet:
+		values, err := seqValues(v)
+		if err != nil {
+			return err
+		}
+		return w.block('[', len(values), ']', func(i int) error {
+			return w.write(values[i])
+		})
+	default:
+		return NewTypeError("JSON value", v)
+	}
+	return nil
+}
+
+// block writes n items with item between open and close, one per line if
+// indenting.
+func (w *jsonWriter) block(open byte, n int, close byte, item func(i int) error) error {
+	w.sb.WriteByte(open)
+	if n > 0 {
+		w.depth++
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				w.sb.WriteByte(',')
+			}
+			w.newline()
+			if err := item(i); err != nil {
+				return err
+			}
+		}
+		w.depth--
+		w.newline()
+	}
+	w.sb.WriteByte(close)
+	return nil
+}
+
+// jsonOptions returns the keyword options of args by name, which must be
+// among allowed.
+func jsonOptions(args []MalValue, allowed ...string) (map[string]MalValue, error) {
+	if len(args)%2 != 0 {
+		return nil, fmt.Errorf("%w: expected keyword options and their values", ErrWrongFuncNArgs)
+	}
+	opts := map[string]MalValue{}
+	for i := 0; i < len(args); i += 2 {
+		kw, _ := args[i].(MalString)
+		name, err := kw.AsKeyword()
+		if err != nil {
+			return nil, NewTypeError("keyword", args[i])
+		}
+		known := false
+		for _, a := range allowed {
+			known = known || a == name
+		}
+		if !known {
+			return nil, NewError(fmt.Sprintf("json: unknown option :%s", name))
+		}
+		opts[name] = args[i+1]
+	}
+	return opts, nil
+}
+
+// jsonDecoderOf returns a decoder of r with the options in args, calling
+// functions in t.
+func jsonDecoderOf(t *Thread, r io.Reader, args []MalValue) (*jsonDecoder, error) {
+	opts, err := jsonOptions(args, "key-fn")
+	if err != nil {
+		return nil, err
+	}
+	var keyFn MalInvoke
+	if f := opts["key-fn"]; f != nil {
+		if keyFn, err = funcArg(f); err != nil {
+			return nil, err
+		}
+	}
+	return newJSONDecoder(r, keyFn, t), nil
+}
+
+// JSONNamespace returns the builtins of the json module.
+func JSONNamespace() Namespace {
+	m := make(map[MalSymbol]MalFunc)
+
+	m[makeSymbol("read-str")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) < 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		s, err := stringArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		d, err := jsonDecoderOf(t, strings.NewReader(s), args[1:])
+		if err != nil {
+			return nil, err
+		}
+		v, ok, err := d.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, NewKindError(ErrKindRead, "json: unexpected end of input")
+		}
+		if _, more, err := d.next(); err != nil || more {
+			if err == nil {
+				err = NewKindError(ErrKindRead, "json: unexpected data after the value")
+			}
+			return nil, err
+		}
+		return v, nil
+	})
+	m[makeSymbol("read")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) < 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		var r io.Reader = os.Stdin
+		if args[0] != nil {
+			path, err := stringArg(args[0])
+			if err != nil {
+				return nil, err
+			}
+			// read at once, so that the file is closed however much of
+			// the sequence is consumed
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			r = bytes.NewReader(content)
+		}
+		d, err := jsonDecoderOf(t, r, args[1:])
+		if err != nil {
+			return nil, err
+		}
+		return d.seq(), nil
+	})
+	m[makeSymbol("write-str")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) < 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		opts, err := jsonOptions(args[1:], "pretty")
+		if err != nil {
+			return nil, err
+		}
+		w := &jsonWriter{}
+		if isTruthy(opts["pretty"]) {
+			w.indent = "  "
+		}
+		if err := w.write(args[0]); err != nil {
+			return nil, err
+		}
+		return NewString(w.sb.String()), nil
+	})
+
+	return Namespace{M: m}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestJSONReadClosesFile(t *testing.T) {
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("open files cannot be counted here")
+	}
+	path := filepath.Join(t.TempDir(), "values.json")
+	if err := os.WriteFile(path, []byte("1 2 3"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	env := InitialEnv()
+	th := NewThread(env.state)
+
+	// only the first value is consumed
+	got, err := rep(th, "(first (json/read "+strconv.Quote(path)+"))", env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "1" {
+		t.Errorf("first value is %s, want 1", got)
+	}
+	after, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) > len(fds) {
+		t.Errorf("%d files open after json/read, %d before", len(after), len(fds))
+	}
+}
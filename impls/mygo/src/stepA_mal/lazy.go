@@ -0,0 +1,429 @@
+package main
+
+// MalLazySeq is a sequence whose elements are computed when first needed
+// and then cached. Once realized, a non-empty MalLazySeq is a cell holding
+// the first element and the rest of the sequence, which may itself be lazy.
+type MalLazySeq struct {
+	thunk func() (MalValue, error) // computes the sequence; nil once realized
+	first MalValue
+	rest  MalValue // nil, MalList or *MalLazySeq
+	empty bool
+}
+
+func (*MalLazySeq) MalValue() {}
+
+// NewLazySeq returns the sequence computed by thunk, which must return
+// nil or a collection.
+func NewLazySeq(thunk func() (MalValue, error)) *MalLazySeq {
+	return &MalLazySeq{thunk: thunk}
+}
+
+// newSeqCell returns the realized sequence of first followed by rest.
+func newSeqCell(first MalValue, rest MalValue) *MalLazySeq {
+	return &MalLazySeq{first: first, rest: rest}
+}
+
+func (s *MalLazySeq) Realized() bool {
+	return s.thunk == nil
+}
+
+// realize computes s if it was not yet. If the computation fails, it is
+// tried again the next time s is needed.
+func (s *MalLazySeq) realize() error {
+	if s.thunk == nil {
+		return nil
+	}
+	v, err := s.thunk()
+	if err != nil {
+		return err
+	}
+	if v != nil && !isColl(v) {
+		return NewTypeError("sequence from lazy-seq", v)
+	}
+	seq, err := seqOf(v)
+	if err != nil {
+		return err
+	}
+	switch seq := seq.(type) {
+	case nil:
+		s.empty = true
+	case MalList:
+		s.first, s.rest = seq.Values[0], NewList(seq.Values[1:])
+	case *MalLazySeq:
+		s.first, s.rest = seq.first, seq.rest
+	}
+	s.thunk = nil
+	return nil
+}
+
+// isSeq reports whether v is a list, a vector or a lazy sequence.
+func isSeq(v MalValue) bool {
+	switch v.(type) {
+	case MalList, *MalLazySeq:
+		return true
+	default:
+		return false
+	}
+}
+
+// uncons returns the first element and the rest of v, which is nil or a
+// collection. ok is false if v is empty.
+func uncons(v MalValue) (first MalValue, rest MalValue, ok bool, err error) {
+	seq, err := seqOf(v)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	switch seq := seq.(type) {
+	case MalList:
+		return seq.Values[0], NewList(seq.Values[1:]), true, nil
+	case *MalLazySeq:
+		return seq.first, seq.rest, true, nil
+	default:
+		return nil, nil, false, nil
+	}
+}
+
+// seqValues returns the elements of v, which is nil or a collection,
+// realizing all of a lazy sequence. It can be interrupted on an infinite sequence.
+func seqValues(v MalValue) ([]MalValue, error) {
+	if l, ok := v.(MalList); ok {
+		return l.Values, nil
+	}
+	return seqPrefix(v, -1)
+}
+
+// seqPrefix returns the first n elements of v, or all of
+// them if n is negative.
+func seqPrefix(v MalValue, n int) ([]MalValue, error) {
+	values := []MalValue{}
+	for n < 0 || len(values) < n {
+		if err := checkInterrupt(); err != nil {
+			return nil, err
+		}
+		first, rest, ok, err := uncons(v)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		values = append(values, first)
+		v = rest
+	}
+	return values, nil
+}
+
+// concatSeq returns the elements of head, s and then of the sequences in more.
+func concatSeq(head MalList, s *MalLazySeq, more []MalValue) *MalLazySeq {
+	var next func(v MalValue, more []MalValue) *MalLazySeq
+	next = func(v MalValue, more []MalValue) *MalLazySeq {
+		return NewLazySeq(func() (MalValue, error) {
+			for {
+				first, rest, ok, err := uncons(v)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					return newSeqCell(first, next(rest, more)), nil
+				}
+				if len(more) == 0 {
+					return nil, nil
+				}
+				v, more = more[0], more[1:]
+			}
+		})
+	}
+	return next(head, append([]MalValue{s}, more...))
+}
+
+func iterateSeq(t *Thread, f MalInvoke, x MalValue) *MalLazySeq {
+	return newSeqCell(x, NewLazySeq(func() (MalValue, error) {
+		y, err := f.Invoke(t, []MalValue{x})
+		if err != nil {
+			return nil, err
+		}
+		return iterateSeq(t, f, y), nil
+	}))
+}
+
+// cycleSeq returns the elements of v followed by those of head, repeated.
+// started is false until the first element of head was returned, so that
+// an empty head gives an empty sequence.
+func cycleSeq(v MalValue, head MalValue, started bool) *MalLazySeq {
+	return NewLazySeq(func() (MalValue, error) {
+		first, rest, ok, err := uncons(v)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			if !started {
+				return nil, nil
+			}
+			return cycleSeq(head, head, true), nil
+		}
+		return newSeqCell(first, cycleSeq(rest, head, true)), nil
+	})
+}
+
+func takeSeq(n int64, v MalValue) *MalLazySeq {
+	return NewLazySeq(func() (MalValue, error) {
+		if n <= 0 {
+			return nil, nil
+		}
+		first, rest, ok, err := uncons(v)
+		if err != nil || !ok {
+			return nil, err
+		}
+		return newSeqCell(first, takeSeq(n-1, rest)), nil
+	})
+}
+
+func dropSeq(n int64, v MalValue) *MalLazySeq {
+	return NewLazySeq(func() (MalValue, error) {
+		for i := int64(0); i < n; i++ {
+			if err := checkInterrupt(); err != nil {
+				return nil, err
+			}
+			_, rest, ok, err := uncons(v)
+			if err != nil || !ok {
+				return nil, err
+			}
+			v = rest
+		}
+		return v, nil
+	})
+}
+
+func takeWhileSeq(t *Thread, pred MalInvoke, v MalValue) *MalLazySeq {
+	return NewLazySeq(func() (MalValue, error) {
+		first, rest, ok, err := uncons(v)
+		if err != nil || !ok {
+			return nil, err
+		}
+		keep, err := pred.Invoke(t, []MalValue{first})
+		if err != nil || !isTruthy(keep) {
+			return nil, err
+		}
+		return newSeqCell(first, takeWhileSeq(t, pred, rest)), nil
+	})
+}
+
+// rangeSeq returns the numbers from start by step, up to end if bounded.
+func rangeSeq(start, step, end MalValue, bounded bool) *MalLazySeq {
+	return NewLazySeq(func() (MalValue, error) {
+		if bounded {
+			// a zero step repeats start forever, unless the range is empty
+			from, to := start, end
+			if negative, err := numLess(step, MalInt{Value: 0}); err != nil {
+				return nil, err
+			} else if negative {
+				from, to = end, start
+			}
+			if more, err := numLess(from, to); err != nil || !more {
+				return nil, err
+			}
+		}
+		next, err := numAdd(start, step)
+		if err != nil {
+			return nil, err
+		}
+		return newSeqCell(start, rangeSeq(next, step, end, bounded)), nil
+	})
+}
+
+func numLess(a, b MalValue) (bool, error) {
+	if a, ok := a.(MalInt); ok {
+		if b, ok := b.(MalInt); ok {
+			return a.Value < b.Value, nil
+		}
+	}
+	x, y, err := numFloats(a, b)
+	return x < y, err
+}
+
+func numAdd(a, b MalValue) (MalValue, error) {
+	if a, ok := a.(MalInt); ok {
+		if b, ok := b.(MalInt); ok {
+			return MalInt{Value: a.Value + b.Value}, nil
+		}
+	}
+	x, y, err := numFloats(a, b)
+	if err != nil {
+		return nil, err
+	}
+	return MalFloat{Value: x + y}, nil
+}
+
+// numFloat returns the number v as a float.
+func numFloat(v MalValue) (float64, error) {
+	switch v := v.(type) {
+	case MalInt:
+		return float64(v.Value), nil
+	case MalFloat:
+		return v.Value, nil
+	default:
+		return 0, NewTypeError("MalInt or MalFloat", v)
+	}
+}
+
+func numFloats(a, b MalValue) (float64, float64, error) {
+	x, err := numFloat(a)
+	if err != nil {
+		return 0, 0, err
+	}
+	y, err := numFloat(b)
+	return x, y, err
+}
+
+func numberArg(v MalValue) (MalValue, error) {
+	switch v.(type) {
+	case MalInt, MalFloat:
+		return v, nil
+	default:
+		return nil, NewTypeError("MalInt or MalFloat", v)
+	}
+}
+
+func intArg(v MalValue) (int64, error) {
+	n, ok := v.(MalInt)
+	if !ok {
+		return 0, NewTypeError("MalInt", v)
+	}
+	return n.Value, nil
+}
+
+// LazyNamespace returns the builtins making lazy sequences.
+func LazyNamespace() Namespace {
+	m := make(map[MalSymbol]MalFunc)
+
+	m[makeSymbol("iterate")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 2 {
+			return nil, ErrWrongFuncNArgs
+		}
+		f, ok := args[0].(MalInvoke)
+		if !ok {
+			return nil, NewTypeError("MalFunc", args[0])
+		}
+		return iterateSeq(t, f, args[1]), nil
+	})
+	m[makeSymbol("repeat")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		switch len(args) {
+		case 1:
+			s := newSeqCell(args[0], nil)
+			s.rest = s
+			return s, nil
+		case 2:
+			n, err := intArg(args[0])
+			if err != nil {
+				return nil, err
+			}
+			values := []MalValue{}
+			for i := int64(0); i < n; i++ {
+				values = append(values, args[1])
+			}
+			return NewList(values), nil
+		default:
+			return nil, ErrWrongFuncNArgs
+		}
+	})
+	m[makeSymbol("cycle")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		if args[0] != nil && !isColl(args[0]) {
+			return nil, NewTypeError("collection", args[0])
+		}
+		return cycleSeq(args[0], args[0], false), nil
+	})
+	m[makeSymbol("range")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		nums := make([]MalValue, len(args))
+		for i, arg := range args {
+			n, err := numberArg(arg)
+			if err != nil {
+				return nil, err
+			}
+			nums[i] = n
+		}
+		zero, one := MalInt{Value: 0}, MalInt{Value: 1}
+		switch len(nums) {
+		case 0:
+			return rangeSeq(zero, one, nil, false), nil
+		case 1:
+			return rangeSeq(zero, one, nums[0], true), nil
+		case 2:
+			return rangeSeq(nums[0], one, nums[1], true), nil
+		case 3:
+			return rangeSeq(nums[0], nums[2], nums[1], true), nil
+		default:
+			return nil, ErrWrongFuncNArgs
+		}
+	})
+	m[makeSymbol("take")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 && len(args) != 2 {
+			return nil, ErrWrongFuncNArgs
+		}
+		n, err := intArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 1 {
+			return takeXf(n), nil
+		}
+		return takeSeq(n, args[1]), nil
+	})
+	m[makeSymbol("drop")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 && len(args) != 2 {
+			return nil, ErrWrongFuncNArgs
+		}
+		n, err := intArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 1 {
+			return dropXf(n), nil
+		}
+		return dropSeq(n, args[1]), nil
+	})
+	m[makeSymbol("take-while")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 && len(args) != 2 {
+			return nil, ErrWrongFuncNArgs
+		}
+		pred, ok := args[0].(MalInvoke)
+		if !ok {
+			return nil, NewTypeError("MalFunc", args[0])
+		}
+		if len(args) == 1 {
+			return takeWhileXf(pred), nil
+		}
+		return takeWhileSeq(t, pred, args[1]), nil
+	})
+	m[makeSymbol("doall")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		if _, err := seqValues(args[0]); err != nil {
+			return nil, err
+		}
+		return args[0], nil
+	})
+	m[makeSymbol("realized?")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		s, ok := args[0].(*MalLazySeq)
+		if !ok {
+			return nil, NewTypeError("lazy sequence", args[0])
+		}
+		return NewBool(s.Realized()), nil
+	})
+
+	return Namespace{M: m}
+}
+
+// evalLazySeq evaluates (lazy-seq body...), whose body is evaluated when
+// the sequence is first needed.
+func evalLazySeq(t *Thread, args []MalValue, replEnv *Env, env *Env) (MalValue, error) {
+	return NewLazySeq(func() (MalValue, error) {
+		return evalBody(t, args, replEnv, env)
+	}), nil
+}
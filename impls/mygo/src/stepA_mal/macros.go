@@ -0,0 +1,296 @@
+package main
+
+import "fmt"
+
+// maxExpansions bounds the number of cached macro expansions. The cache
+// is cleared when it is full.
+const maxExpansions = 10000
+
+// callSite identifies a macro call by the backing array of its list form,
+// so that the same form read or produced once is expanded once however
+// often it runs, and by the environment defining the macro it calls, since
+// the same form may name different macros where it runs. Defining a macro
+// clears the cache, so the defining environment stands for the macro.
+type callSite struct {
+	first *MalValue
+	n     int
+	macro *Env
+}
+
+// macroexpand1 expands ast once if it is a macro call, and reports
+// whether it was.
+func macroexpand1(t *Thread, ast MalValue, replEnv *Env, env *Env) (MalValue, bool, error) {
+	lst, ok := ast.(MalList)
+	if !ok || len(lst.Values) == 0 {
+		return ast, false, nil
+	}
+	sym, ok := lst.Values[0].(MalSymbol)
+	if !ok {
+		return ast, false, nil
+	}
+	// looked up once, as another thread may redefine the macro meanwhile
+	macroV, _ := lookupSymbol(t, sym.Value, replEnv, env)
+	macro, ok := macroV.(MalInvoke)
+	if !ok || !macro.IsMacro() {
+		return ast, false, nil
+	}
+
+	expanded, err := macro.Invoke(t, lst.Values[1:])
+	if err != nil {
+		return nil, false, fmt.Errorf("error while expanding macro: %w", err)
+	}
+	return expanded, true, nil
+}
+
+func macroexpand(t *Thread, ast MalValue, replEnv *Env, env *Env) (MalValue, error) {
+	for {
+		expanded, ok, err := macroexpand1(t, ast, replEnv, env)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return ast, nil
+		}
+		ast = expanded
+	}
+}
+
+// expand is macroexpand with each expansion step cached per call site.
+// The cache is only consulted when the head of a form still names a macro,
+// so that a local binding shadowing the macro is seen.
+func (t *Thread) expand(p MalList, replEnv *Env, env *Env) (MalValue, error) {
+	var form MalValue = p
+	for isMacroCall(t, form, replEnv, env) {
+		l := form.(MalList)
+		macroEnv, _, _ := findVar(l.Values[0].(MalSymbol).Value, replEnv, env)
+		site := callSite{first: &l.Values[0], n: len(l.Values), macro: macroEnv}
+		expanded, ok := t.state.cachedExpansion(site)
+		if !ok {
+			var err error
+			if expanded, _, err = macroexpand1(t, l, replEnv, env); err != nil {
+				return nil, err
+			}
+			t.state.cacheExpansion(site, expanded)
+		}
+		form = expanded
+	}
+	return form, nil
+}
+
+// The cache of expansions is shared by the threads of the interpreter, and
+// the lock is not held while expanding, which may define macros.
+
+func (s *EvalState) cachedExpansion(site callSite) (MalValue, bool) {
+	s.expansionsMu.Lock()
+	defer s.expansionsMu.Unlock()
+	expanded, ok := s.expansions[site]
+	return expanded, ok
+}
+
+func (s *EvalState) cacheExpansion(site callSite, expanded MalValue) {
+	s.expansionsMu.Lock()
+	defer s.expansionsMu.Unlock()
+	if len(s.expansions) >= maxExpansions {
+		s.expansions = make(map[callSite]MalValue)
+	}
+	s.expansions[site] = expanded
+}
+
+// invalidateExpansions forgets all cached expansions. It is called
+// whenever a macro is defined or redefined.
+func (s *EvalState) invalidateExpansions() {
+	s.expansionsMu.Lock()
+	defer s.expansionsMu.Unlock()
+	if len(s.expansions) > 0 {
+		s.expansions = make(map[callSite]MalValue)
+	}
+}
+
+func isMacro(v MalValue) bool {
+	f, ok := v.(MalInvoke)
+	return ok && f.IsMacro()
+}
+
+// macroexpandAll expands all the macro calls in ast, leaving alone the
+// parts of special forms that are not evaluated, such as binding names
+// and quoted forms. Quasiquotes are replaced by their expansion. The
+// names bound by fn*, let*, binding, catch* and restart-case shadow the
+// macros of the same name in their body, as they do when evaluated.
+func macroexpandAll(t *Thread, ast MalValue, replEnv *Env, env *Env) (MalValue, error) {
+	ast, err := macroexpand(t, ast, replEnv, env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch a := ast.(type) {
+	case MalList:
+		if a.IsVector() || len(a.Values) == 0 {
+			return expandAllFrom(t, a, 0, replEnv, env)
+		}
+		head, ok := a.Values[0].(MalSymbol)
+		if !ok {
+			return expandAllFrom(t, a, 0, replEnv, env)
+		}
+		switch head.Value {
+		case "quote", "var", "ns", "macroexpand", "macroexpand-1", "macroexpand-all":
+			return a, nil
+		case "quasiquote":
+			if len(a.Values) != 2 {
+				return a, nil
+			}
+			q, err := quasiquote(t, a.Values[1], replEnv)
+			if err != nil {
+				return nil, err
+			}
+			return macroexpandAll(t, q, replEnv, env)
+		case "def!", "defmacro!", "def-dynamic!":
+			// (def! name value)
+			return expandAllFrom(t, a, 2, replEnv, env)
+		case "fn*":
+			// (fn* params body)
+			if len(a.Values) < 2 {
+				return a, nil
+			}
+			params, _ := a.Values[1].(MalList)
+			return expandAllFrom(t, a, 2, replEnv, shadow(env, params.Values...))
+		case "catch*":
+			// (catch* e body), (catch* filter e body)
+			if len(a.Values) < 3 {
+				return a, nil
+			}
+			if len(a.Values) == 3 {
+				return expandAllFrom(t, a, 2, replEnv, shadow(env, a.Values[1]))
+			}
+			filter, err := macroexpandAll(t, a.Values[1], replEnv, env)
+			if err != nil {
+				return nil, err
+			}
+			rest, err := expandAllFrom(t, a, 3, replEnv, shadow(env, a.Values[2]))
+			if err != nil {
+				return nil, err
+			}
+			rest.Values[1] = filter
+			return rest, nil
+		case "let*", "binding":
+			return expandLet(t, a, replEnv, env)
+		case "restart-case":
+			return expandRestartCase(t, a, replEnv, env)
+		default:
+			return expandAllFrom(t, a, 1, replEnv, env)
+		}
+	case *MalMap:
+		m := NewMap()
+		for _, entry := range a.Iter() {
+			k, err := macroexpandAll(t, entry.Key, replEnv, env)
+			if err != nil {
+				return nil, err
+			}
+			v, err := macroexpandAll(t, entry.Value, replEnv, env)
+			if err != nil {
+				return nil, err
+			}
+			m.Set(k, v)
+		}
+		m.SetMeta(a.GetMeta())
+		return m, nil
+	default:
+		return ast, nil
+	}
+}
+
+// expandAllFrom returns a copy of l with the elements from index i on
+// fully expanded.
+func expandAllFrom(t *Thread, l MalList, i int, replEnv *Env, env *Env) (MalList, error) {
+	values := make([]MalValue, len(l.Values))
+	copy(values, l.Values)
+	for ; i < len(values); i++ {
+		v, err := macroexpandAll(t, values[i], replEnv, env)
+		if err != nil {
+			return MalList{}, err
+		}
+		values[i] = v
+	}
+	return MalList{Values: values, Vector: l.Vector, Meta: l.Meta}, nil
+}
+
+// shadow returns an environment extending env in which the symbols among
+// names are bound, so that the macros they name are not expanded.
+func shadow(env *Env, names ...MalValue) *Env {
+	inner, _ := NewEnv(env, nil, nil)
+	for _, name := range names {
+		if sym, ok := name.(MalSymbol); ok {
+			inner.Set(sym.Value, nil)
+		}
+	}
+	return inner
+}
+
+// expandLet expands (let* (name value...) body) and (binding (name
+// value...) body). The values of let* see the names bound before them,
+// those of binding only the outer ones.
+func expandLet(t *Thread, l MalList, replEnv *Env, env *Env) (MalValue, error) {
+	if len(l.Values) < 2 {
+		return l, nil
+	}
+	bindings, ok := l.Values[1].(MalList)
+	if !ok {
+		return l, nil
+	}
+	sequential := l.Values[0].(MalSymbol).Value == "let*"
+	values := make([]MalValue, len(bindings.Values))
+	copy(values, bindings.Values)
+	inner := shadow(env)
+	for i := 1; i < len(values); i += 2 {
+		valueEnv := env
+		if sequential {
+			valueEnv = inner
+		}
+		v, err := macroexpandAll(t, values[i], replEnv, valueEnv)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+		if sym, ok := values[i-1].(MalSymbol); ok {
+			inner.Set(sym.Value, nil)
+		}
+	}
+
+	result, err := expandAllFrom(t, l, 2, replEnv, inner)
+	if err != nil {
+		return nil, err
+	}
+	result.Values[1] = MalList{Values: values, Vector: bindings.Vector, Meta: bindings.Meta}
+	return result, nil
+}
+
+// expandRestartCase expands (restart-case expr (name (params...) body...)...).
+func expandRestartCase(t *Thread, l MalList, replEnv *Env, env *Env) (MalValue, error) {
+	values := make([]MalValue, len(l.Values))
+	copy(values, l.Values)
+	for i := 1; i < len(values); i++ {
+		if i == 1 {
+			v, err := macroexpandAll(t, values[i], replEnv, env)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+			continue
+		}
+		clause, ok := values[i].(MalList)
+		if !ok {
+			continue
+		}
+		var params []MalValue
+		if len(clause.Values) > 1 {
+			if l, ok := clause.Values[1].(MalList); ok {
+				params = l.Values
+			}
+		}
+		v, err := expandAllFrom(t, clause, 2, replEnv, shadow(env, params...))
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return MalList{Values: values, Meta: l.Meta}, nil
+}
@@ -5,47 +5,228 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 )
 
-func macroexpand(ast MalValue, env *Env) (MalValue, error) {
-	for isMacroCall(ast, env) {
-		lst := ast.(MalList)
-		sym := lst.Values[0].(MalSymbol)
-		macroV, ok := env.Get(sym.Value)
-		if !ok {
-			panic("unreachable")
+// evalDef evaluates (def! name value), (defmacro! name value) and
+// (def-dynamic! name value), where a docstring may precede value and name
+// may carry metadata such as ^:dynamic.
+func evalDef(t *Thread, form string, def MalList, replEnv *Env, env *Env) (MalValue, error) {
+	rawArgs := def.Values[1:]
+	if len(rawArgs) != 2 && len(rawArgs) != 3 {
+		return nil, fmt.Errorf("%w for def", ErrWrongFuncNArgs)
+	}
+	key, meta, err := defName(rawArgs[0])
+	if err != nil {
+		return nil, err
+	}
+	var doc MalValue
+	if len(rawArgs) == 3 {
+		s, ok := rawArgs[1].(MalString)
+		if !ok || s.IsKeyword() {
+			return nil, syntaxError("docstring of %s must be a string, got %v", form, rawArgs[1])
 		}
-		macro := macroV.(MalInvoke)
+		doc = s
+	}
+	dynamic := form == "def-dynamic!" || isDynamicMeta(meta)
+	if dynamic && env.state == nil {
+		return nil, syntaxError("dynamic var %v must be defined at top level", key)
+	}
+	val, err := eval(t, rawArgs[len(rawArgs)-1], replEnv, env)
+	if err != nil {
+		return nil, err
+	}
 
-		args := lst.Values[1:]
-		expanded, err := macro.Invoke(args)
-		if err != nil {
-			return nil, fmt.Errorf("error while expanding macro: %w", err)
+	switch f := val.(type) {
+	case MalFunc:
+		if f.Name == "" {
+			f.Name = key.Value
+			val = f
+		}
+	case MalTcoFunc:
+		if f.Fn.Name == "" {
+			f.Fn.Name = key.Value
+			val = f
 		}
+	}
 
-		ast = expanded
+	state := replEnv.state
+	if form == "defmacro!" {
+		switch f := val.(type) {
+		case MalFunc:
+			f.Macro = true
+			val = f
+		case MalTcoFunc:
+			f.Fn.Macro = true
+			val = f
+		default:
+			return nil, syntaxError("defmacro! must be a function")
+		}
+	}
+	if old, ok := env.M[key.Value]; isMacro(val) || ok && isMacro(old) {
+		state.invalidateExpansions()
 	}
 
-	return ast, nil
+	env.Set(key.Value, val)
+	varMeta := defMeta(key, val, doc, meta, def, env)
+	if dynamic {
+		varMeta.Set(NewKeyword("dynamic"), NewBool(true))
+		env.markDynamic(key.Value)
+	}
+	env.setVarMeta(key.Value, varMeta)
+	return val, nil
 }
 
-func read(param string) (MalValue, error) {
-	return ReadStr(param)
+// tryClause returns the clause if v is a list starting with the symbol name.
+func tryClause(v MalValue, name string) (MalList, bool) {
+	l, ok := v.(MalList)
+	if !ok || l.IsVector() || len(l.Values) == 0 {
+		return MalList{}, false
+	}
+	sym, ok := l.Values[0].(MalSymbol)
+	return l, ok && sym.Value == name
 }
 
-func eval(param MalValue, replEnv *Env, env *Env) (MalValue, error) {
+// catchMatches reports whether the catch clause, with its leading
+// catch* removed, handles malError. A clause is either (catch* e body),
+// or (catch* filter e body) where filter is an error kind keyword or an
+// expression evaluating to a predicate on the caught value.
+func catchMatches(t *Thread, clause []MalValue, malError *MalError, replEnv *Env, env *Env) (bool, error) {
+	if len(clause) == 2 {
+		return true, nil
+	}
+
+	if kw, ok := clause[0].(MalString); ok {
+		if kind, err := kw.AsKeyword(); err == nil {
+			return malError.Is(ErrorKind(kind)), nil
+		}
+	}
+	pred, err := eval(t, clause[0], replEnv, env)
+	if err != nil {
+		return false, err
+	}
+	f, ok := pred.(MalInvoke)
+	if !ok {
+		return false, syntaxError("catch filter must be a keyword or a function, got %v", pred)
+	}
+	matched, err := f.Invoke(t, []MalValue{malError.Value()})
+	if err != nil {
+		return false, err
+	}
+	return isTruthy(matched), nil
+}
+
+// evalTry evaluates (try* body... (catch* ...)... (finally* ...)).
+// The first catch* clause matching the error handles it; if none
+// matches, the error is rethrown. The handled error is recorded while its
+// catch* body runs, for ex-kind and the other accessors to find from the
+// bound value. finally* runs however control leaves the block, including
+// on interruption and restarts.
+func evalTry(t *Thread, args []MalValue, replEnv *Env, env *Env) (result MalValue, err error) {
+	body := []MalValue{}
+	catches := [][]MalValue{}
+	var finally []MalValue
+	for _, arg := range args {
+		if finally != nil {
+			return nil, syntaxError("finally* must be the last clause of try*")
+		}
+		if c, ok := tryClause(arg, "catch*"); ok {
+			if len(c.Values) != 3 && len(c.Values) != 4 {
+				return nil, syntaxError("catch must have 2 or 3 arguments, got %v", c)
+			}
+			if _, ok := c.Values[len(c.Values)-2].(MalSymbol); !ok {
+				return nil, syntaxError("catch binding must be a symbol, got %v", c.Values[len(c.Values)-2])
+			}
+			catches = append(catches, c.Values[1:])
+			continue
+		}
+		if f, ok := tryClause(arg, "finally*"); ok {
+			finally = append([]MalValue{}, f.Values[1:]...)
+			continue
+		}
+		if len(catches) > 0 {
+			return nil, syntaxError("try* body must come before catch*, got %v", arg)
+		}
+		body = append(body, arg)
+	}
+
+	if finally != nil {
+		defer func() {
+			// let cleanup run to completion even if we were interrupted
+			interrupted := resetInterrupt()
+			defer func() {
+				if interrupted {
+					Interrupt()
+				}
+			}()
+			for _, form := range finally {
+				if _, ferr := eval(t, form, replEnv, env); ferr != nil {
+					result, err = nil, ferr
+					return
+				}
+			}
+		}()
+	}
+
+	for _, form := range body {
+		result, err = eval(t, form, replEnv, env)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil || isControlTransfer(err) {
+		return result, err
+	}
+
+	malError := NewErrorFromError(err)
+	for _, clause := range catches {
+		matched, merr := catchMatches(t, clause, malError, replEnv, env)
+		if merr != nil {
+			return nil, merr
+		}
+		if !matched {
+			continue
+		}
+		bind := clause[len(clause)-2].(MalSymbol)
+		catchEnv, err := NewEnv(env, []string{bind.Value}, []MalValue{malError.Value()})
+		if err != nil {
+			return nil, err
+		}
+		t.caught = append(t.caught, malError)
+		defer func() {
+			t.caught = t.caught[:len(t.caught)-1]
+		}()
+		return eval(t, clause[len(clause)-1], replEnv, catchEnv)
+	}
+	return nil, err
+}
+
+func read(t *Thread, param string) (MalValue, error) {
+	return readFirst(t.codeReader(param))
+}
+
+func eval(t *Thread, param MalValue, replEnv *Env, env *Env) (MalValue, error) {
+	if err := t.enterEval(); err != nil {
+		return nil, err
+	}
+	defer t.leaveEval()
+
 	for {
+		if err := checkInterrupt(); err != nil {
+			return nil, err
+		}
+
 		switch p := param.(type) {
 		case MalList:
 			if p.IsVector() {
-				return EvalAst(param, replEnv, env)
+				return EvalAst(t, param, replEnv, env)
 			}
 
 			if len(p.Values) == 0 {
 				return param, nil
 			}
 
-			expanded, err := macroexpand(p, env)
+			expanded, err := t.expand(p, replEnv, env)
 			if err != nil {
 				return nil, err
 			}
@@ -54,7 +235,7 @@ func eval(param MalValue, replEnv *Env, env *Env) (MalValue, error) {
 				param = expanded
 				p = param.(MalList)
 			default:
-				evaled, err := EvalAst(expanded, replEnv, env)
+				evaled, err := EvalAst(t, expanded, replEnv, env)
 				if err != nil {
 					return nil, err
 				}
@@ -69,112 +250,65 @@ func eval(param MalValue, replEnv *Env, env *Env) (MalValue, error) {
 				switch h.Value {
 				case "try*":
 					if len(rawArgs) < 1 {
-						return nil, fmt.Errorf("wrong number of arguments for try*")
-					}
-					tryExpr := rawArgs[0]
-					tried, err := eval(tryExpr, replEnv, env)
-					if err != nil {
-						// if catch* is not set
-						// just throw error
-						if len(rawArgs) < 2 {
-							return nil, err
-						}
-
-						malError, ok := err.(*MalError)
-						if !ok {
-							// internal error
-							// convert to mal error
-							malError = NewErrorFromError(err)
-						}
-
-						// catch
-						catchList, ok := rawArgs[1].(MalList)
-						if !ok {
-							return nil, fmt.Errorf("catch must be a list")
-						}
-						if len(catchList.Values) != 3 {
-							return nil, fmt.Errorf("catch must have 3 arguments")
-						}
-						catchSym, ok := catchList.Values[0].(MalSymbol)
-						if !ok || catchSym.Value != "catch*" {
-							return nil, fmt.Errorf("catch must start with catch*")
-						}
-
-						catchBind, ok := catchList.Values[1].(MalSymbol)
-						if !ok {
-							return nil, fmt.Errorf("catch binding must be a symbol")
-						}
-
-						catchBody := catchList.Values[2]
-						catchEnv, err := NewEnv(env, []string{catchBind.Value}, []MalValue{malError.Value()})
-						if err != nil {
-							panic("unreachable: " + err.Error())
-						}
-
-						return eval(catchBody, replEnv, catchEnv)
+						return nil, fmt.Errorf("%w for try*", ErrWrongFuncNArgs)
 					}
-					return tried, nil
+					return evalTry(t, rawArgs, replEnv, env)
+				case "lazy-seq":
+					return evalLazySeq(t, rawArgs, replEnv, env)
+				case "binding":
+					return evalBinding(t, rawArgs, replEnv, env)
+				case "ns":
+					return evalNs(t, rawArgs, replEnv)
+				case "handler-bind":
+					return evalHandlerBind(t, rawArgs, replEnv, env)
+				case "restart-case":
+					return evalRestartCase(t, rawArgs, replEnv, env)
 				case "macroexpand":
 					if len(rawArgs) != 1 {
-						return nil, fmt.Errorf("wrong number of arguments for macroexpand")
+						return nil, fmt.Errorf("%w for macroexpand", ErrWrongFuncNArgs)
 					}
-					expanded, err := macroexpand(rawArgs[0], env)
+					expanded, err := macroexpand(t, rawArgs[0], replEnv, env)
 					if err != nil {
 						return nil, err
 					}
 					return expanded, nil
-				case "eval":
+				case "macroexpand-1":
 					if len(rawArgs) != 1 {
-						return nil, fmt.Errorf("wrong number of arguments eval")
+						return nil, fmt.Errorf("%w for macroexpand-1", ErrWrongFuncNArgs)
 					}
-					arg0, err := eval(rawArgs[0], replEnv, env)
+					expanded, _, err := macroexpand1(t, rawArgs[0], replEnv, env)
 					if err != nil {
 						return nil, err
 					}
-					return eval(arg0, replEnv, replEnv) // evaluate in replEnv
-				case "defmacro!":
-					fallthrough
-				case "def!":
-					if len(rawArgs) != 2 {
-						return nil, fmt.Errorf("wrong number of arguments for def")
+					return expanded, nil
+				case "macroexpand-all":
+					if len(rawArgs) != 1 {
+						return nil, fmt.Errorf("%w for macroexpand-all", ErrWrongFuncNArgs)
 					}
-					key, ok := rawArgs[0].(MalSymbol)
-					if !ok {
-						return nil, fmt.Errorf("arg0 of def! must be MalSymbol, got %v", rawArgs[0])
+					return macroexpandAll(t, rawArgs[0], replEnv, env)
+				case "eval":
+					if len(rawArgs) != 1 {
+						return nil, fmt.Errorf("%w for eval", ErrWrongFuncNArgs)
 					}
-					val, err := eval(rawArgs[1], replEnv, env)
+					arg0, err := eval(t, rawArgs[0], replEnv, env)
 					if err != nil {
 						return nil, err
 					}
-
-					if h.Value == "defmacro!" {
-						switch f := val.(type) {
-						case MalFunc:
-							f.Macro = true
-							env.Set(key.Value, f)
-							return f, nil
-						case MalTcoFunc:
-							f.Fn.Macro = true
-							env.Set(key.Value, f)
-							return f, nil
-						default:
-							return nil, fmt.Errorf("defmacro! must be a function")
-						}
-					}
-
-					env.Set(key.Value, val)
-					return val, nil
+					current := t.CurrentEnv()
+					return eval(t, arg0, current, current) // evaluate in the current module
+				case "def!", "defmacro!", "def-dynamic!":
+					return evalDef(t, h.Value, p, replEnv, env)
 				case "let*":
 					if len(rawArgs) != 2 {
-						return nil, fmt.Errorf("wrong number of arguments for let*")
+						return nil, fmt.Errorf("%w for let*", ErrWrongFuncNArgs)
 					}
 
 					bindings, ok := rawArgs[0].(MalList)
 					if !ok {
-						return nil, fmt.Errorf("arg0 of let* must be MalList, got %v", rawArgs[0])
+						return nil, syntaxError("arg0 of let* must be MalList, got %v", rawArgs[0])
 					}
 					if len(bindings.Values)%2 != 0 {
-						return nil, fmt.Errorf("bindings must be even, got %v", bindings)
+						return nil, syntaxError("bindings must be even, got %v", bindings)
 					}
 					env, err = NewEnv(env, nil, nil)
 					if err != nil {
@@ -183,9 +317,9 @@ func eval(param MalValue, replEnv *Env, env *Env) (MalValue, error) {
 					for i := 0; i < len(bindings.Values); i += 2 {
 						key, ok := bindings.Values[i].(MalSymbol)
 						if !ok {
-							return nil, fmt.Errorf("binding key must be MalSymbol, got %v", bindings.Values[i])
+							return nil, syntaxError("binding key must be MalSymbol, got %v", bindings.Values[i])
 						}
-						val, err := eval(bindings.Values[i+1], replEnv, env)
+						val, err := eval(t, bindings.Values[i+1], replEnv, env)
 						if err != nil {
 							return nil, err
 						}
@@ -196,10 +330,10 @@ func eval(param MalValue, replEnv *Env, env *Env) (MalValue, error) {
 					continue
 				case "do":
 					if len(rawArgs) == 0 {
-						return nil, fmt.Errorf("wrong number of arguments for do")
+						return nil, fmt.Errorf("%w for do", ErrWrongFuncNArgs)
 					}
 					for _, arg := range rawArgs[:len(rawArgs)-1] {
-						_, err := eval(arg, replEnv, env)
+						_, err := eval(t, arg, replEnv, env)
 						if err != nil {
 							return nil, err
 						}
@@ -208,21 +342,14 @@ func eval(param MalValue, replEnv *Env, env *Env) (MalValue, error) {
 					continue
 				case "if":
 					if len(rawArgs) != 2 && len(rawArgs) != 3 {
-						return nil, fmt.Errorf("wrong number of arguments for if")
+						return nil, fmt.Errorf("%w for if", ErrWrongFuncNArgs)
 					}
-					cond, err := eval(rawArgs[0], replEnv, env)
+					cond, err := eval(t, rawArgs[0], replEnv, env)
 					if err != nil {
 						return nil, err
 					}
 
-					truthy := true
-					if cond == nil {
-						truthy = false
-					} else if b, ok := cond.(MalBool); ok {
-						truthy = b.Value
-					}
-
-					if truthy {
+					if isTruthy(cond) {
 						param = rawArgs[1]
 						continue
 					} else {
@@ -234,46 +361,63 @@ func eval(param MalValue, replEnv *Env, env *Env) (MalValue, error) {
 						}
 					}
 				case "fn*":
-					if len(rawArgs) != 2 {
-						return nil, fmt.Errorf("wrong number of arguments for fn*")
+					if len(rawArgs) != 2 && len(rawArgs) != 3 {
+						return nil, fmt.Errorf("%w for fn*", ErrWrongFuncNArgs)
+					}
+					var fnMeta MalValue
+					if len(rawArgs) == 3 {
+						// (fn* params docstring body)
+						doc, ok := rawArgs[1].(MalString)
+						if !ok || doc.IsKeyword() {
+							return nil, syntaxError("docstring of fn* must be a string, got %v", rawArgs[1])
+						}
+						meta := NewMap()
+						meta.Set(NewKeyword("doc"), doc)
+						fnMeta = meta
+						rawArgs = []MalValue{rawArgs[0], rawArgs[2]}
 					}
 
 					params, ok := rawArgs[0].(MalList)
 					if !ok {
-						return nil, fmt.Errorf("first argument of fn* must be MalList, got %v", rawArgs[0])
+						return nil, syntaxError("first argument of fn* must be MalList, got %v", rawArgs[0])
 					}
 					paramStrs := make([]string, len(params.Values))
 					for i, p := range params.Values {
 						sym, ok := p.(MalSymbol)
 						if !ok {
-							return nil, fmt.Errorf("parameter must be MalSymbol, got %v", p)
+							return nil, syntaxError("parameter must be MalSymbol, got %v", p)
 						}
 						paramStrs[i] = sym.Value
 					}
 
-					fn := func(args []MalValue) (MalValue, error) {
+					fn := func(t *Thread, args []MalValue) (MalValue, error) {
 						newEnv, err := NewEnv(env, paramStrs, args)
 						if err != nil {
 							return nil, err
 						}
-						return eval(rawArgs[1], replEnv, newEnv)
+						return eval(t, rawArgs[1], replEnv, newEnv)
 					}
-					return MalTcoFunc{Ast: rawArgs[1], Params: paramStrs, Env: env, Fn: MalFunc{F: fn}}, nil
+					return MalTcoFunc{Ast: rawArgs[1], Params: paramStrs, Env: env, Ns: replEnv, Fn: MalFunc{F: fn, Meta: fnMeta}}, nil
 				case "quote":
 					if len(rawArgs) != 1 {
-						return nil, fmt.Errorf("wrong number of arguments for quote")
+						return nil, fmt.Errorf("%w for quote", ErrWrongFuncNArgs)
 					}
 					return rawArgs[0], nil
+				case "var":
+					if len(rawArgs) != 1 {
+						return nil, fmt.Errorf("%w for var", ErrWrongFuncNArgs)
+					}
+					return evalVar(rawArgs[0], replEnv, env)
 				case "quasiquoteexpand":
 					if len(rawArgs) != 1 {
-						return nil, fmt.Errorf("wrong number of arguments for quasiquoteexpand")
+						return nil, fmt.Errorf("%w for quasiquoteexpand", ErrWrongFuncNArgs)
 					}
-					return quasiquote(rawArgs[0], false)
+					return quasiquote(t, rawArgs[0], replEnv)
 				case "quasiquote":
 					if len(rawArgs) != 1 {
-						return nil, fmt.Errorf("wrong number of arguments for quasiquote")
+						return nil, fmt.Errorf("%w for quasiquote", ErrWrongFuncNArgs)
 					}
-					q, err := quasiquote(rawArgs[0], false)
+					q, err := quasiquote(t, rawArgs[0], replEnv)
 					if err != nil {
 						return nil, err
 					}
@@ -282,7 +426,7 @@ func eval(param MalValue, replEnv *Env, env *Env) (MalValue, error) {
 				}
 			}
 
-			evalListR, err := EvalAst(p, replEnv, env)
+			evalListR, err := EvalAst(t, p, replEnv, env)
 			if err != nil {
 				return nil, err
 			}
@@ -295,50 +439,78 @@ func eval(param MalValue, replEnv *Env, env *Env) (MalValue, error) {
 
 			switch f := head.(type) {
 			case MalFunc:
-				return f.F(args)
+				t.applying(f.Name)
+				return f.Invoke(t, args)
 			case MalTcoFunc:
+				t.applying(f.Fn.Name)
 				param = f.Ast
+				replEnv = f.Ns
 				env, err = NewEnv(f.Env, f.Params, args)
 				if err != nil {
 					return nil, err
 				}
 				continue
 			default:
-				return nil, fmt.Errorf("not a function: %v", head)
+				return nil, NewTypeError("function", head)
 			}
 		default:
-			return EvalAst(param, replEnv, env)
+			return EvalAst(t, param, replEnv, env)
 		}
 	}
 }
 
-func print(param MalValue) string {
-	return PrStr(param, true)
+func print(t *Thread, param MalValue, env *Env) (string, error) {
+	var sb strings.Builder
+	opts := printOptionsFromEnv(t, env, true)
+	if pretty, ok := t.get(env, "*print-pretty*"); ok && isTruthy(pretty) {
+		err := PprWrite(&sb, param, opts, printWidthFromEnv(t, env))
+		return sb.String(), err
+	}
+	err := PrWrite(&sb, param, opts)
+	return sb.String(), err
 }
 
-func rep(param string, env *Env) (string, error) {
-	step1, err := read(param)
+func rep(t *Thread, param string, env *Env) (result string, err error) {
+	defer recoverError(&err)
+	resetInterrupt()
+
+	step1, err := read(t, param)
 	if err != nil {
 		if errors.Is(err, ErrReadNoToken) {
 			return "", nil
 		}
 		return "", err
 	}
-	step2, err := eval(step1, env, env)
+	step2, err := eval(t, step1, env, env)
+	if err != nil {
+		return "", err
+	}
+	step3, err := print(t, step2, env)
 	if err != nil {
 		return "", err
 	}
-	step3 := print(step2)
 	return step3, nil
 }
 
 func main() {
 	env := InitialEnv()
-
-	rep("(def! load-file (fn* (f) (eval (read-string (str \"(do \" (slurp f) \"\nnil)\")))))", env)
-	rep("(def! not (fn* (a) (if a false true)))", env)
-	rep("(defmacro! cond (fn* (& xs) (if (> (count xs) 0) (list 'if (first xs) (if (> (count xs) 1) (nth xs 1) (throw \"odd number of forms to cond\")) (cons 'cond (rest (rest xs)))))))", env)
-	rep("(def! *host-language* \"Go\")", env)
+	t := NewThread(env.state)
+
+	rep(t, "(def! not \"Returns true if a is nil or false.\" (fn* (a) (if a false true)))", env)
+	rep(t, "(defmacro! cond \"Evaluates the expression after the first test that is neither nil nor false.\" (fn* (& xs) (if (> (count xs) 0) (list 'if (first xs) (if (> (count xs) 1) (nth xs 1) (throw \"odd number of forms to cond\")) (cons 'cond (rest (rest xs)))))))", env)
+	rep(t, "(defmacro! doc \"Prints the documentation of the definition or special form called name.\" (fn* (name) `(print-doc (quote ~name))))", env)
+	rep(t, "(defmacro! source \"Prints the source of the definition called name.\" (fn* (name) `(print-source (quote ~name))))", env)
+	rep(t, "(defmacro! arglists \"Returns the parameter lists of the definition called name.\" (fn* (name) `(get (var-meta (quote ~name)) :arglists)))", env)
+	rep(t, "(defmacro! dir \"Prints the sorted names defined in the namespace ns.\" (fn* (ns) `(do (map println (dir-fn (quote ~ns))) nil)))", env)
+	rep(t, "(def-dynamic! *host-language* \"The language the interpreter is written in, whose keyword reader conditionals read.\" \""+HostLanguage+"\")", env)
+	rep(t, "(def-dynamic! *print-pretty* \"Whether the REPL pretty prints results.\" false)", env)
+	rep(t, "(def-dynamic! *print-right-margin* \"The width within which pprint and the REPL pretty print.\" 80)", env)
+	rep(t, "(def-dynamic! *print-length* \"The number of elements of a collection printed before ..., or nil for all but the elements of a lazy sequence past 10000.\" nil)", env)
+	rep(t, "(def-dynamic! *print-level* \"The depth of nested collections printed before ..., or nil for all.\" nil)", env)
+	rep(t, "(def-dynamic! *data-readers* \"The reader functions of the tagged literals read by edn/read-string, by tag symbol.\" {})", env)
+	env.Set("*load-path*", NewList(loadPathFromEnviron()))
+	env.markDynamic("*load-path*")
+	rep(t, "(def-dynamic! *qualify-syntax-quote* \"Whether quasiquote qualifies free symbols by the namespace defining them.\" false)", env)
 
 	if len(os.Args) > 1 {
 		filename := os.Args[1]
@@ -351,7 +523,9 @@ func main() {
 		argList := NewList(argValues)
 		env.Set("*ARGV*", argList)
 
-		_, err := rep("(load-file \""+filename+"\")", env)
+		stop := interruptOnSignal()
+		err := t.loadFile(filename)
+		stop()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s\n", err)
 			os.Exit(1)
@@ -360,14 +534,14 @@ func main() {
 	}
 
 	// REPL start
-	rep(`(println (str "Mal [" *host-language* "]"))`, env)
+	rep(t, `(println (str "Mal [" *host-language* "]"))`, env)
 
 	// empty *ARGV*
 	env.Set("*ARGV*", NewList(nil))
 
 	scanner := bufio.NewScanner(os.Stdin)
 	for {
-		prompt := "user> "
+		prompt := t.current.Name + "> "
 		fmt.Print(prompt)
 
 		scanner.Scan()
@@ -378,7 +552,10 @@ func main() {
 			break
 		}
 
-		result, err := rep(userInput, env)
+		// Ctrl-C interrupts the evaluation, and exits at the prompt
+		stop := interruptOnSignal()
+		result, err := rep(t, userInput, t.CurrentEnv())
+		stop()
 		if err != nil {
 			fmt.Printf("Error: %s\n", err)
 			continue
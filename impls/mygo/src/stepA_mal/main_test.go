@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFinallyRunsOnInterrupt(t *testing.T) {
+	env := InitialEnv()
+	th := NewThread(env.state)
+	started := make(chan struct{})
+	env.Set("started", makeFunc(func(*Thread, []MalValue) (MalValue, error) {
+		close(started)
+		return nil, nil
+	}))
+	if _, err := rep(th, "(def! loop (fn* () (loop)))", env); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rep(th, "(def! cleaned (atom false))", env); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := rep(th, "(try* (do (started) (loop)) (catch* e :caught) (finally* (reset! cleaned true)))", env)
+		done <- err
+	}()
+	<-started
+	Interrupt()
+	if err := <-done; !errors.Is(err, ErrKindInterrupted) {
+		t.Fatalf("got error %v, want :interrupted", err)
+	}
+
+	cleaned, err := rep(th, "@cleaned", env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cleaned != "true" {
+		t.Errorf("finally* was not run on interrupt, cleaned is %s", cleaned)
+	}
+}
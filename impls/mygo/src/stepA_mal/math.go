@@ -0,0 +1,354 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// MathModuleName is the name of the module of the math builtins, which
+// are called as math/sqrt or through an alias.
+const MathModuleName = "math"
+
+var (
+	errDivideByZero    = NewError("divide by zero")
+	errIntegerOverflow = NewError("integer overflow")
+)
+
+// newRandom returns a generator for the random builtins, seeded from the
+// clock.
+func newRandom() *rand.Rand {
+	return rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+// random calls f with the generator of the random builtins of s, which is
+// shared by the threads of the interpreter.
+func (s *EvalState) random(f func(r *rand.Rand)) {
+	s.rngMu.Lock()
+	defer s.rngMu.Unlock()
+	f(s.rng)
+}
+
+// floatArg returns the number v as a float.
+func floatArg(v MalValue) (float64, error) {
+	return numFloat(v)
+}
+
+// intDivide implements quot, rem and mod on integers, whose results have
+// the sign of a for rem and of b for mod.
+func intDivide(op string, a, b int64) (int64, error) {
+	if b == 0 {
+		return 0, errDivideByZero
+	}
+	switch op {
+	case "quot":
+		return a / b, nil
+	case "rem":
+		return a % b, nil
+	default:
+		m := a % b
+		if m != 0 && (m < 0) != (b < 0) {
+			m += b
+		}
+		return m, nil
+	}
+}
+
+func floatDivide(op string, a, b float64) (float64, error) {
+	if b == 0 {
+		return 0, errDivideByZero
+	}
+	switch op {
+	case "quot":
+		return math.Trunc(a / b), nil
+	case "rem":
+		return math.Mod(a, b), nil
+	default:
+		m := math.Mod(a, b)
+		if m != 0 && (m < 0) != (b < 0) {
+			m += b
+		}
+		return m, nil
+	}
+}
+
+// MathNamespace returns the builtins of the math module. The random
+// builtins share one generator per interpreter, which seed! resets so that
+// a run can be repeated.
+func MathNamespace(env *Env) Namespace {
+	m := make(map[MalSymbol]MalFunc)
+
+	// floatFn makes a builtin of one number, returning a float
+	floatFn := func(f func(x float64) float64) MalFunc {
+		return makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+			if len(args) != 1 {
+				return nil, ErrWrongFuncNArgs
+			}
+			x, err := floatArg(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return NewFloat(f(x)), nil
+		})
+	}
+	// float2Fn makes a builtin of two numbers, returning a float
+	float2Fn := func(f func(x, y float64) float64) MalFunc {
+		return makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+			if len(args) != 2 {
+				return nil, ErrWrongFuncNArgs
+			}
+			x, err := floatArg(args[0])
+			if err != nil {
+				return nil, err
+			}
+			y, err := floatArg(args[1])
+			if err != nil {
+				return nil, err
+			}
+			return NewFloat(f(x, y)), nil
+		})
+	}
+	// divideFn makes quot, rem or mod, which return an integer if both
+	// arguments are integers
+	divideFn := func(op string) MalFunc {
+		return makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+			if len(args) != 2 {
+				return nil, ErrWrongFuncNArgs
+			}
+			if a, ok := args[0].(MalInt); ok {
+				if b, ok := args[1].(MalInt); ok {
+					n, err := intDivide(op, a.Value, b.Value)
+					return MalInt{Value: n}, err
+				}
+			}
+			a, err := floatArg(args[0])
+			if err != nil {
+				return nil, err
+			}
+			b, err := floatArg(args[1])
+			if err != nil {
+				return nil, err
+			}
+			f, err := floatDivide(op, a, b)
+			if err != nil {
+				return nil, err
+			}
+			return NewFloat(f), nil
+		})
+	}
+	// extremumFn makes min or max, which return the argument for which
+	// better is true against all the others
+	extremumFn := func(better func(a, b MalValue) (bool, error)) MalFunc {
+		return makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+			if len(args) < 1 {
+				return nil, ErrWrongFuncNArgs
+			}
+			best, err := numberArg(args[0])
+			if err != nil {
+				return nil, err
+			}
+			for _, x := range args[1:] {
+				if x, err = numberArg(x); err != nil {
+					return nil, err
+				}
+				if wins, err := better(x, best); err != nil {
+					return nil, err
+				} else if wins {
+					best = x
+				}
+			}
+			return best, nil
+		})
+	}
+	// bitFn makes a builtin combining one or more integers with op
+	bitFn := func(op func(a, b int64) int64) MalFunc {
+		return makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+			if len(args) < 1 {
+				return nil, ErrWrongFuncNArgs
+			}
+			acc, err := intArg(args[0])
+			if err != nil {
+				return nil, err
+			}
+			for _, x := range args[1:] {
+				n, err := intArg(x)
+				if err != nil {
+					return nil, err
+				}
+				acc = op(acc, n)
+			}
+			return MalInt{Value: acc}, nil
+		})
+	}
+	// shiftFn makes a builtin shifting an integer by n bits, of which only
+	// the low six are used
+	shiftFn := func(shift func(x int64, n uint) int64) MalFunc {
+		return makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+			if len(args) != 2 {
+				return nil, ErrWrongFuncNArgs
+			}
+			x, err := intArg(args[0])
+			if err != nil {
+				return nil, err
+			}
+			n, err := intArg(args[1])
+			if err != nil {
+				return nil, err
+			}
+			return MalInt{Value: shift(x, uint(n)&63)}, nil
+		})
+	}
+
+	m[makeSymbol("quot")] = divideFn("quot")
+	m[makeSymbol("rem")] = divideFn("rem")
+	m[makeSymbol("mod")] = divideFn("mod")
+	m[makeSymbol("abs")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		switch x := args[0].(type) {
+		case MalInt:
+			if x.Value == math.MinInt64 {
+				return nil, errIntegerOverflow
+			}
+			if x.Value < 0 {
+				return MalInt{Value: -x.Value}, nil
+			}
+			return x, nil
+		case MalFloat:
+			return NewFloat(math.Abs(x.Value)), nil
+		default:
+			return nil, NewTypeError("MalInt or MalFloat", args[0])
+		}
+	})
+	m[makeSymbol("min")] = extremumFn(numLess)
+	m[makeSymbol("max")] = extremumFn(func(a, b MalValue) (bool, error) {
+		return numLess(b, a)
+	})
+	m[makeSymbol("sqrt")] = floatFn(math.Sqrt)
+	m[makeSymbol("cbrt")] = floatFn(math.Cbrt)
+	m[makeSymbol("pow")] = float2Fn(math.Pow)
+	m[makeSymbol("exp")] = floatFn(math.Exp)
+	m[makeSymbol("log")] = floatFn(math.Log)
+	m[makeSymbol("log10")] = floatFn(math.Log10)
+	m[makeSymbol("sin")] = floatFn(math.Sin)
+	m[makeSymbol("cos")] = floatFn(math.Cos)
+	m[makeSymbol("tan")] = floatFn(math.Tan)
+	m[makeSymbol("asin")] = floatFn(math.Asin)
+	m[makeSymbol("acos")] = floatFn(math.Acos)
+	m[makeSymbol("atan")] = floatFn(math.Atan)
+	m[makeSymbol("atan2")] = float2Fn(math.Atan2)
+	m[makeSymbol("floor")] = floatFn(math.Floor)
+	m[makeSymbol("ceil")] = floatFn(math.Ceil)
+	m[makeSymbol("round")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		x, err := floatArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		r := math.Round(x)
+		// -2^63 is exact as a float, 2^63-1 is not and rounds to 2^63
+		if !(r >= math.MinInt64 && r < -math.MinInt64) {
+			return nil, errIntegerOverflow
+		}
+		return MalInt{Value: int64(r)}, nil
+	})
+
+	m[makeSymbol("bit-and")] = bitFn(func(a, b int64) int64 { return a & b })
+	m[makeSymbol("bit-or")] = bitFn(func(a, b int64) int64 { return a | b })
+	m[makeSymbol("bit-xor")] = bitFn(func(a, b int64) int64 { return a ^ b })
+	m[makeSymbol("bit-and-not")] = bitFn(func(a, b int64) int64 { return a &^ b })
+	m[makeSymbol("bit-not")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		x, err := intArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return MalInt{Value: ^x}, nil
+	})
+	m[makeSymbol("bit-shift-left")] = shiftFn(func(x int64, n uint) int64 { return x << n })
+	m[makeSymbol("bit-shift-right")] = shiftFn(func(x int64, n uint) int64 { return x >> n })
+	m[makeSymbol("unsigned-bit-shift-right")] = shiftFn(func(x int64, n uint) int64 {
+		return int64(uint64(x) >> n)
+	})
+
+	m[makeSymbol("seed!")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		seed, err := intArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		env.state.random(func(r *rand.Rand) { r.Seed(seed) })
+		return nil, nil
+	})
+	m[makeSymbol("rand")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) > 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		n := 1.0
+		if len(args) == 1 {
+			var err error
+			if n, err = floatArg(args[0]); err != nil {
+				return nil, err
+			}
+		}
+		var x float64
+		env.state.random(func(r *rand.Rand) { x = r.Float64() })
+		return NewFloat(x * n), nil
+	})
+	m[makeSymbol("rand-int")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		n, err := intArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if n <= 0 {
+			return nil, NewKindError(ErrKindType, "rand-int expects a positive bound")
+		}
+		var x int64
+		env.state.random(func(r *rand.Rand) { x = r.Int63n(n) })
+		return MalInt{Value: x}, nil
+	})
+	m[makeSymbol("rand-nth")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		n, err := countOf(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, NewKindError(ErrKindIndex, "rand-nth of an empty collection")
+		}
+		var i int64
+		env.state.random(func(r *rand.Rand) { i = r.Int63n(int64(n)) })
+		return nthOf(args[0], i)
+	})
+	m[makeSymbol("shuffle")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		values, err := seqValues(args[0])
+		if err != nil {
+			return nil, err
+		}
+		shuffled := make([]MalValue, len(values))
+		copy(shuffled, values)
+		env.state.random(func(r *rand.Rand) {
+			r.Shuffle(len(shuffled), func(i, j int) {
+				shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+			})
+		})
+		return NewVector(shuffled), nil
+	})
+
+	return Namespace{M: m}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestConcurrentRandom(t *testing.T) {
+	env := InitialEnv()
+	th := NewThread(env.state)
+	var done sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		done.Add(1)
+		go func(th *Thread) {
+			defer done.Done()
+			if _, err := rep(th, "(math/shuffle [1 2 3 (math/rand-int 10) (math/rand)])", env); err != nil {
+				t.Error(err)
+			}
+		}(th.Fork())
+	}
+	done.Wait()
+}
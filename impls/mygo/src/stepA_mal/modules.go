@@ -0,0 +1,354 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// CoreModuleName is the name of the module of the builtins, by which
+// syntax-quote qualifies them.
+const CoreModuleName = "core"
+
+// Module is a namespace of definitions, created by ns or by loading a
+// file with require. Its environment sees the core builtins but not the
+// definitions of other modules, which are reached through qualified
+// symbols such as str/join.
+type Module struct {
+	Name    string
+	Env     *Env
+	aliases map[string]string // alias -> module name
+
+	loadMu sync.Mutex // held while the module is loaded from its file
+	loaded bool       // loaded from a file by require
+}
+
+// module returns the module called name, creating it if needed.
+func (s *EvalState) module(name string) *Module {
+	s.modulesMu.Lock()
+	defer s.modulesMu.Unlock()
+	if m, ok := s.modules[name]; ok {
+		return m
+	}
+	m := &Module{Name: name, aliases: make(map[string]string)}
+	m.Env = &Env{M: make(map[string]MalValue), Outer: s.core, state: s, module: m}
+	s.modules[name] = m
+	return m
+}
+
+// defineModule makes the builtins of ns a module called name, which is
+// required without loading a file.
+func (s *EvalState) defineModule(name string, ns Namespace) {
+	m := s.module(name)
+	m.loaded = true
+	for k, v := range ns.M {
+		v.Name = k.Value
+		m.Env.Set(k.Value, v)
+		m.Env.setVarMeta(k.Value, builtinMeta(name, k.Value))
+	}
+}
+
+// findModule returns the module called name, if there is one.
+func (s *EvalState) findModule(name string) (*Module, bool) {
+	s.modulesMu.Lock()
+	defer s.modulesMu.Unlock()
+	m, ok := s.modules[name]
+	return m, ok
+}
+
+// moduleList returns the modules of s, in no particular order.
+func (s *EvalState) moduleList() []*Module {
+	s.modulesMu.Lock()
+	defer s.modulesMu.Unlock()
+	modules := make([]*Module, 0, len(s.modules))
+	for _, m := range s.modules {
+		modules = append(modules, m)
+	}
+	return modules
+}
+
+func splitQualified(name string) (string, string, bool) {
+	i := strings.Index(name, "/")
+	if i <= 0 || i == len(name)-1 {
+		return "", "", false
+	}
+	return name[:i], name[i+1:], true
+}
+
+// lookupSymbol resolves name in env, or as a symbol qualified by a module
+// name or by an alias of the module in which replEnv was defined.
+func lookupSymbol(t *Thread, name string, replEnv *Env, env *Env) (MalValue, bool) {
+	if v, ok := t.get(env, name); ok {
+		return v, true
+	}
+	nsName, sym, ok := splitQualified(name)
+	if !ok {
+		return nil, false
+	}
+	if replEnv.module != nil {
+		if full, ok := replEnv.module.aliases[nsName]; ok {
+			nsName = full
+		}
+	}
+	m, ok := replEnv.state.findModule(nsName)
+	if !ok {
+		return nil, false
+	}
+	return t.value(m.Env, sym)
+}
+
+// loadPathFromEnviron returns the initial *load-path*: the directories
+// listed in MAL_PATH, followed by the working directory.
+func loadPathFromEnviron() []MalValue {
+	dirs := []MalValue{}
+	for _, dir := range filepath.SplitList(os.Getenv("MAL_PATH")) {
+		if dir != "" {
+			dirs = append(dirs, NewString(dir))
+		}
+	}
+	return append(dirs, NewString("."))
+}
+
+// loadPath returns the directories searched by require, from *load-path*.
+func (t *Thread) loadPath() []string {
+	v, ok := t.get(t.CurrentEnv(), "*load-path*")
+	if !ok {
+		return []string{"."}
+	}
+	l, ok := v.(MalList)
+	if !ok {
+		return []string{"."}
+	}
+	dirs := []string{}
+	for _, dir := range l.Values {
+		if dir, ok := dir.(MalString); ok {
+			dirs = append(dirs, dir.Value)
+		}
+	}
+	return dirs
+}
+
+// findModuleFile maps a module name such as foo.bar to foo/bar.mal
+// in the first directory of the load path that contains it.
+func (t *Thread) findModuleFile(name string) (string, bool) {
+	rel := filepath.FromSlash(strings.ReplaceAll(name, ".", "/")) + ".mal"
+	for _, dir := range t.loadPath() {
+		path := filepath.Join(dir, rel)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// loadFile evaluates the forms in path one by one in the current module,
+// which they may change with ns. The current module is restored afterwards.
+func (t *Thread) loadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	forms, err := readAll(t.codeReader(string(content)))
+	if err != nil {
+		return err
+	}
+
+	saved := t.current
+	defer func() {
+		t.current = saved
+	}()
+	for _, form := range forms {
+		env := t.CurrentEnv()
+		if _, err := eval(t, form, env, env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load loads the module called name from its file, unless it was
+// already loaded. A thread requiring a module that another thread is
+// loading waits for it to be loaded.
+func (t *Thread) load(name string) (*Module, error) {
+	for i, loading := range t.loading {
+		if loading == name {
+			chain := append(append([]string{}, t.loading[i:]...), name)
+			return nil, NewKindError(ErrKindCircularRequire, "circular require: "+strings.Join(chain, " -> "))
+		}
+	}
+	existing, defined := t.state.findModule(name)
+	if defined {
+		existing.loadMu.Lock()
+		defer existing.loadMu.Unlock()
+		if existing.loaded {
+			return existing, nil
+		}
+	}
+
+	path, ok := t.findModuleFile(name)
+	if !ok {
+		if defined {
+			// defined with ns rather than in a file
+			return existing, nil
+		}
+		return nil, NewKindError(ErrKindNamespaceNotFound, fmt.Sprintf("namespace %s not found in %v", name, t.loadPath()))
+	}
+
+	m := existing
+	if !defined {
+		m = t.state.module(name)
+		m.loadMu.Lock()
+		defer m.loadMu.Unlock()
+		if m.loaded {
+			return m, nil
+		}
+	}
+
+	t.loading = append(t.loading, name)
+	saved := t.current
+	t.current = m
+	defer func() {
+		t.loading = t.loading[:len(t.loading)-1]
+		t.current = saved
+	}()
+	if err := t.loadFile(path); err != nil {
+		return nil, err
+	}
+	m.loaded = true
+	return m, nil
+}
+
+// require loads the module named by spec into the current module.
+// spec is either a symbol or a list such as [foo.bar :as fb :refer [x y]],
+// where :refer may also be :all.
+func (t *Thread) require(spec MalValue) error {
+	var opts []MalValue
+	if l, ok := spec.(MalList); ok {
+		if len(l.Values) == 0 {
+			return syntaxError("empty require spec")
+		}
+		spec, opts = l.Values[0], l.Values[1:]
+	}
+	name, ok := spec.(MalSymbol)
+	if !ok {
+		return syntaxError("require spec must start with a symbol, got %v", spec)
+	}
+	if len(opts)%2 != 0 {
+		return syntaxError("require options must be pairs, got %v", NewList(opts))
+	}
+
+	into := t.current
+	m, err := t.load(name.Value)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(opts); i += 2 {
+		switch PrStr(opts[i], true) {
+		case ":as":
+			alias, ok := opts[i+1].(MalSymbol)
+			if !ok {
+				return syntaxError(":as must be followed by a symbol, got %v", opts[i+1])
+			}
+			into.aliases[alias.Value] = m.Name
+		case ":refer":
+			if err := refer(into, m, opts[i+1]); err != nil {
+				return err
+			}
+		default:
+			return syntaxError("unknown require option %v", opts[i])
+		}
+	}
+	return nil
+}
+
+// refer copies definitions of m into the module into.
+func refer(into *Module, m *Module, names MalValue) error {
+	if kw, ok := names.(MalString); ok && kw.Value == NewKeyword("all").Value {
+		for k, v := range m.Env.M {
+			into.Env.Set(k, v)
+		}
+		into.Env.state.invalidateExpansions()
+		return nil
+	}
+	l, ok := names.(MalList)
+	if !ok {
+		return syntaxError(":refer must be followed by a list of symbols or :all, got %v", names)
+	}
+	for _, name := range l.Values {
+		sym, ok := name.(MalSymbol)
+		if !ok {
+			return syntaxError(":refer must be followed by a list of symbols or :all, got %v", names)
+		}
+		v, ok := m.Env.M[sym.Value]
+		if !ok {
+			return NewKindError(ErrKindUnbound, fmt.Sprintf("'%s/%s' not found", m.Name, sym.Value))
+		}
+		into.Env.Set(sym.Value, v)
+		if isMacro(v) {
+			into.Env.state.invalidateExpansions()
+		}
+	}
+	return nil
+}
+
+// evalNs evaluates (ns name (:require spec...)...), which makes name
+// the current module.
+func evalNs(t *Thread, args []MalValue, replEnv *Env) (MalValue, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("%w for ns", ErrWrongFuncNArgs)
+	}
+	name, ok := args[0].(MalSymbol)
+	if !ok {
+		return nil, syntaxError("namespace name must be a symbol, got %v", args[0])
+	}
+
+	t.current = replEnv.state.module(name.Value)
+	for _, arg := range args[1:] {
+		clause, ok := arg.(MalList)
+		if !ok || len(clause.Values) == 0 || PrStr(clause.Values[0], true) != ":require" {
+			return nil, syntaxError("unsupported ns clause %v", arg)
+		}
+		for _, spec := range clause.Values[1:] {
+			if err := t.require(spec); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, nil
+}
+
+// ModuleNamespace returns the builtins for loading code, which act on
+// the modules of the interpreter of env.
+func ModuleNamespace(env *Env) Namespace {
+	m := make(map[MalSymbol]MalFunc)
+
+	m[makeSymbol("require")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		for _, spec := range args {
+			if err := t.require(spec); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	m[makeSymbol("load-file")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		path, ok := args[0].(MalString)
+		if !ok {
+			return nil, NewTypeError("MalString", args[0])
+		}
+		return nil, t.loadFile(path.Value)
+	})
+	m[makeSymbol("ns-name")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 0 {
+			return nil, ErrWrongFuncNArgs
+		}
+		return makeSymbol(t.current.Name), nil
+	})
+
+	return Namespace{M: m}
+}
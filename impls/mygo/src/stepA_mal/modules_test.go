@@ -0,0 +1,47 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestConcurrentNs(t *testing.T) {
+	env := InitialEnv()
+	th := NewThread(env.state)
+	var barrier sync.WaitGroup
+	barrier.Add(2)
+	// wait returns once both goroutines have switched module
+	env.Set("wait", makeFunc(func(*Thread, []MalValue) (MalValue, error) {
+		barrier.Done()
+		barrier.Wait()
+		return nil, nil
+	}))
+
+	want := []string{"first", "second"}
+	got := make([]string, len(want))
+	errs := make([]error, len(want))
+	var done sync.WaitGroup
+	for i, name := range want {
+		done.Add(1)
+		go func(i int, name string, th *Thread) {
+			defer done.Done()
+			if _, errs[i] = rep(th, "(ns "+name+")", env); errs[i] != nil {
+				return
+			}
+			got[i], errs[i] = rep(th, "(do (wait) (ns-name))", env)
+		}(i, name, th.Fork())
+	}
+	done.Wait()
+
+	for i := range want {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if got[i] != want[i] {
+			t.Errorf("current module is %s in goroutine %d, want %s", got[i], i, want[i])
+		}
+	}
+	if name, err := rep(th, "(ns-name)", env); err != nil || name != "user" {
+		t.Errorf("current module is %s after the ns forms, want user (%v)", name, err)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const DefaultPrintWidth = 80
+
+// doc is a node of the Wadler-style document algebra used by the pretty printer.
+type doc interface {
+	isDoc()
+}
+
+type docText string
+type docLine struct{}
+type docNest struct {
+	Indent int
+	Doc    doc
+}
+type docGroup struct {
+	Doc doc
+}
+type docConcat []doc
+
+func (docText) isDoc()   {}
+func (docLine) isDoc()   {}
+func (docNest) isDoc()   {}
+func (docGroup) isDoc()  {}
+func (docConcat) isDoc() {}
+
+// specialFormArgs is the number of arguments kept on the head line
+// before the body of a special form is indented.
+var specialFormArgs = map[string]int{
+	"def!":         1,
+	"defmacro!":    1,
+	"def-dynamic!": 1,
+	"binding":      1,
+	"fn*":          1,
+	"let*":         1,
+	"if":           1,
+	"do":           0,
+	"try*":         0,
+	"catch*":       1,
+	"finally*":     0,
+	"cond":         0,
+	"when":         1,
+	"quote":        0,
+	"handler-bind": 1,
+	"restart-case": 1,
+}
+
+var bindingForms = map[string]bool{
+	"let*":         true,
+	"handler-bind": true,
+	"binding":      true,
+}
+
+func joinDocs(docs []doc, sep doc) doc {
+	result := docConcat{}
+	for i, d := range docs {
+		if i != 0 {
+			result = append(result, sep)
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+func pairDocs(values []doc) []doc {
+	pairs := []doc{}
+	for i := 0; i < len(values); i += 2 {
+		if i+1 >= len(values) {
+			pairs = append(pairs, values[i])
+			break
+		}
+		pairs = append(pairs, docGroup{docConcat{values[i], docLine{}, values[i+1]}})
+	}
+	return pairs
+}
+
+func bracketDoc(open string, items []doc, close string) doc {
+	return docGroup{docConcat{
+		docText(open),
+		docNest{Indent: len(open), Doc: joinDocs(items, docLine{})},
+		docText(close),
+	}}
+}
+
+func (p *printer) docs(values []MalValue) []doc {
+	docs := []doc{}
+	for i, v := range values {
+		if p.truncated(i) {
+			docs = append(docs, docText("..."))
+			break
+		}
+		docs = append(docs, p.doc(v))
+	}
+	return docs
+}
+
+// doc builds the document for v, honoring the same limits as print.
+func (p *printer) doc(v MalValue) doc {
+	switch vv := v.(type) {
+	case MalList:
+		if !p.enter() {
+			return docText("...")
+		}
+		defer p.leave()
+		if vv.IsVector() {
+			return bracketDoc("[", p.docs(vv.Values), "]")
+		}
+		return p.listDoc(vv)
+	case *MalLazySeq:
+		if !p.enter() {
+			return docText("...")
+		}
+		defer p.leave()
+		return bracketDoc("(", p.docs(p.lazyValues(vv)), ")")
+	case *MalMap, *MalSortedMap:
+		if !p.enter() {
+			return docText("...")
+		}
+		defer p.leave()
+		entries, _ := mapEntries(vv)
+		kvs := []doc{}
+		for i, kv := range entries {
+			if p.truncated(i) {
+				kvs = append(kvs, docText("..."))
+				break
+			}
+			kvs = append(kvs, p.doc(kv.Key), p.doc(kv.Value))
+		}
+		return bracketDoc("{", pairDocs(kvs), "}")
+	case *MalAtom:
+		if p.atoms[vv] {
+			return docText("#<cycle>")
+		}
+		p.atoms[vv] = true
+		defer delete(p.atoms, vv)
+		return docGroup{docConcat{
+			docText("(atom"),
+			docNest{Indent: 2, Doc: docConcat{docLine{}, p.doc(vv.Ref)}},
+			docText(")"),
+		}}
+	default:
+		return docText(PrStrOpts(v, p.opts))
+	}
+}
+
+func (p *printer) listDoc(l MalList) doc {
+	if len(l.Values) == 0 {
+		return docText("()")
+	}
+
+	sym, ok := l.Values[0].(MalSymbol)
+	nArgs, special := specialFormArgs[sym.Value]
+	if !ok || !special || len(l.Values) <= nArgs+1 || p.truncated(nArgs+1) {
+		return bracketDoc("(", p.docs(l.Values), ")")
+	}
+
+	args := []doc{}
+	for i, arg := range l.Values[1:] {
+		if p.truncated(i + 1) {
+			args = append(args, docText("..."))
+			break
+		}
+		if i == 0 && bindingForms[sym.Value] {
+			args = append(args, p.bindingsDoc(arg))
+		} else {
+			args = append(args, p.doc(arg))
+		}
+	}
+
+	head := docConcat{docText("(" + sym.Value)}
+	for _, arg := range args[:nArgs] {
+		head = append(head, docText(" "), arg)
+	}
+
+	body := args[nArgs:]
+	if sym.Value == "cond" {
+		body = pairDocs(body)
+	}
+
+	return docGroup{docConcat{
+		head,
+		docNest{Indent: 2, Doc: docConcat{docLine{}, joinDocs(body, docLine{})}},
+		docText(")"),
+	}}
+}
+
+func (p *printer) bindingsDoc(v MalValue) doc {
+	l, ok := v.(MalList)
+	if !ok {
+		return p.doc(v)
+	}
+	if !p.enter() {
+		return docText("...")
+	}
+	defer p.leave()
+	open, close := "(", ")"
+	if l.IsVector() {
+		open, close = "[", "]"
+	}
+	return bracketDoc(open, pairDocs(p.docs(l.Values)), close)
+}
+
+type layoutCmd struct {
+	indent int
+	flat   bool
+	doc    doc
+}
+
+// fits reports whether cmd, followed by the pending commands in rest,
+// can be laid out within width columns up to the next line break.
+func fits(width int, cmd layoutCmd, rest []layoutCmd) bool {
+	stack := []layoutCmd{cmd}
+	restIdx := len(rest) - 1
+	for width >= 0 {
+		if len(stack) == 0 {
+			if restIdx < 0 {
+				return true
+			}
+			stack = append(stack, rest[restIdx])
+			restIdx--
+			continue
+		}
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		switch d := c.doc.(type) {
+		case docText:
+			width -= utf8.RuneCountInString(string(d))
+		case docLine:
+			if !c.flat {
+				return true
+			}
+			width--
+		case docNest:
+			stack = append(stack, layoutCmd{c.indent + d.Indent, c.flat, d.Doc})
+		case docGroup:
+			stack = append(stack, layoutCmd{c.indent, c.flat, d.Doc})
+		case docConcat:
+			for i := len(d) - 1; i >= 0; i-- {
+				stack = append(stack, layoutCmd{c.indent, c.flat, d[i]})
+			}
+		}
+	}
+	return false
+}
+
+func layout(w io.Writer, d doc, width int) error {
+	bw := bufio.NewWriter(w)
+	col := 0
+	stack := []layoutCmd{{0, false, d}}
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		switch d := c.doc.(type) {
+		case docText:
+			bw.WriteString(string(d))
+			col += utf8.RuneCountInString(string(d))
+		case docLine:
+			if c.flat {
+				bw.WriteString(" ")
+				col++
+			} else {
+				bw.WriteString("\n")
+				bw.WriteString(strings.Repeat(" ", c.indent))
+				col = c.indent
+			}
+		case docNest:
+			stack = append(stack, layoutCmd{c.indent + d.Indent, c.flat, d.Doc})
+		case docGroup:
+			flat := layoutCmd{c.indent, true, d.Doc}
+			if c.flat || fits(width-col, flat, stack) {
+				stack = append(stack, flat)
+			} else {
+				stack = append(stack, layoutCmd{c.indent, false, d.Doc})
+			}
+		case docConcat:
+			for i := len(d) - 1; i >= 0; i-- {
+				stack = append(stack, layoutCmd{c.indent, c.flat, d[i]})
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// PprWrite is like PrWrite but breaks nested forms across lines so that
+// the output fits in width columns where possible.
+func PprWrite(w io.Writer, v MalValue, opts PrintOptions, width int) error {
+	p := newPrinter(w, opts)
+	d := p.doc(v)
+	if p.err != nil {
+		return p.err
+	}
+	return layout(w, d, width)
+}
+
+func PprStr(v MalValue, opts PrintOptions, width int) string {
+	var sb strings.Builder
+	PprWrite(&sb, v, opts, width)
+	return sb.String()
+}
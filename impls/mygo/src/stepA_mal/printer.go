@@ -1,10 +1,70 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
 	"strconv"
 	"strings"
 )
 
+// PrintOptions controls how values are printed.
+// A negative Length or Level means no limit.
+type PrintOptions struct {
+	Readably bool
+	Length   int  // maximum number of items printed per collection
+	Level    int  // maximum nesting depth of collections
+	EDN      bool // fail on values that cannot be read back as EDN
+}
+
+func DefaultPrintOptions(readably bool) PrintOptions {
+	return PrintOptions{Readably: readably, Length: -1, Level: -1}
+}
+
+// printOptionsFromEnv reads *print-length* and *print-level* from env, as
+// bound in t.
+func printOptionsFromEnv(t *Thread, env *Env, readably bool) PrintOptions {
+	opts := DefaultPrintOptions(readably)
+	if v, ok := t.get(env, "*print-length*"); ok {
+		if n, ok := v.(MalInt); ok {
+			opts.Length = int(n.Value)
+		}
+	}
+	if v, ok := t.get(env, "*print-level*"); ok {
+		if n, ok := v.(MalInt); ok {
+			opts.Level = int(n.Value)
+		}
+	}
+	return opts
+}
+
+// printWidthFromEnv reads *print-right-margin* from env, as bound in t.
+func printWidthFromEnv(t *Thread, env *Env) int {
+	if w, ok := t.get(env, "*print-right-margin*"); ok {
+		if w, ok := w.(MalInt); ok {
+			return int(w.Value)
+		}
+	}
+	return DefaultPrintWidth
+}
+
+// floatLiteral formats the finite f with the fewest digits that read back
+// as the same float, and with a fraction or an exponent so that it is not
+// read back as an integer.
+func floatLiteral(f float64) string {
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	s := strconv.FormatFloat(f, format, -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
 func readableString(s string) string {
 	s = strings.ReplaceAll(s, "\\", "\\\\")
 	s = strings.ReplaceAll(s, "\"", "\\\"")
@@ -12,77 +72,375 @@ func readableString(s string) string {
 	return s
 }
 
-func PrStr(v MalValue, readably bool) string {
+type printer struct {
+	w     io.Writer
+	opts  PrintOptions
+	level int
+	atoms map[*MalAtom]bool // atoms being printed, for cycle detection
+	err   error
+}
+
+func newPrinter(w io.Writer, opts PrintOptions) *printer {
+	return &printer{w: w, opts: opts, atoms: make(map[*MalAtom]bool)}
+}
+
+func (p *printer) write(s string) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = io.WriteString(p.w, s)
+}
+
+// enter reports whether one more level of nesting may be printed.
+func (p *printer) enter() bool {
+	if p.opts.Level >= 0 && p.level >= p.opts.Level {
+		return false
+	}
+	p.level++
+	return true
+}
+
+func (p *printer) leave() {
+	p.level--
+}
+
+// truncated reports whether the i-th item of a collection is past *print-length*.
+func (p *printer) truncated(i int) bool {
+	return p.opts.Length >= 0 && i >= p.opts.Length
+}
+
+func (p *printer) printSeq(open string, values []MalValue, close string) {
+	if !p.enter() {
+		p.write("...")
+		return
+	}
+	defer p.leave()
+
+	p.write(open)
+	for i, value := range values {
+		if i != 0 {
+			p.write(" ")
+		}
+		if p.truncated(i) {
+			p.write("...")
+			break
+		}
+		p.print(value)
+	}
+	p.write(close)
+}
+
+// DefaultLazyPrintLength is the number of elements of a lazy sequence
+// printed when there is no *print-length*, so that printing an infinite
+// sequence ends.
+const DefaultLazyPrintLength = 10000
+
+// lazyValues returns the elements of s to be printed, realizing only one
+// more than *print-length* so that infinite sequences can be printed.
+// Without *print-length*, the elements past DefaultLazyPrintLength are
+// replaced by the symbol ..., printed as a truncated collection ends.
+func (p *printer) lazyValues(s *MalLazySeq) []MalValue {
+	n := p.opts.Length + 1
+	if p.opts.Length < 0 {
+		n = DefaultLazyPrintLength + 1
+	}
+	values, err := seqPrefix(s, n)
+	if err != nil && p.err == nil {
+		p.err = err
+	}
+	if p.opts.Length < 0 && len(values) > DefaultLazyPrintLength {
+		values[DefaultLazyPrintLength] = makeSymbol("...")
+	}
+	return values
+}
+
+func (p *printer) printMap(entries []MalMapEntry) {
+	if !p.enter() {
+		p.write("...")
+		return
+	}
+	defer p.leave()
+
+	p.write("{")
+	for i, kv := range entries {
+		if i != 0 {
+			p.write(" ")
+		}
+		if p.truncated(i) {
+			p.write("...")
+			break
+		}
+		p.print(kv.Key)
+		p.write(" ")
+		p.print(kv.Value)
+	}
+	p.write("}")
+}
+
+func (p *printer) printAtom(a *MalAtom) {
+	if p.atoms[a] {
+		p.write("#<cycle>")
+		return
+	}
+	p.atoms[a] = true
+	defer delete(p.atoms, a)
+
+	p.write("(atom ")
+	p.print(a.Ref)
+	p.write(")")
+}
+
+func (p *printer) printError(e *MalError) {
+	m := NewMap()
+	m.Set(NewKeyword("kind"), e.Kind().Keyword())
+	m.Set(NewKeyword("message"), e.Message())
+	if e.Data() != nil {
+		m.Set(NewKeyword("data"), e.Data())
+	}
+	if cause := e.Cause(); cause != nil {
+		m.Set(NewKeyword("cause"), cause)
+	}
+	p.write("#error ")
+	p.printMap(m.Iter())
+}
+
+func funcString(kind string, name string, params []string) string {
+	str := "#<" + kind
+	if name != "" {
+		str += " " + name
+	}
+	if params != nil {
+		arity := len(params)
+		variadic := false
+		for i, param := range params {
+			if param == "&" {
+				arity = i
+				variadic = true
+				break
+			}
+		}
+		str += "/" + strconv.Itoa(arity)
+		if variadic {
+			str += "+"
+		}
+	}
+	return str + ">"
+}
+
+func funcKind(macro bool) string {
+	if macro {
+		return "macro"
+	}
+	return "function"
+}
+
+func (p *printer) print(v MalValue) {
 	if v == nil {
-		return "nil"
+		p.write("nil")
+		return
+	}
+	if p.opts.EDN && !isEDN(v) {
+		if p.err == nil {
+			p.err = NewTypeError("EDN value", v)
+		}
+		return
 	}
 
 	switch vv := v.(type) {
 	case MalSymbol:
-		return vv.Value
+		p.write(vv.Value)
 	case MalInt:
-		return strconv.FormatInt(vv.Value, 10)
+		p.write(strconv.FormatInt(vv.Value, 10))
 	case MalFloat:
-		return strconv.FormatFloat(vv.Value, 'f', -1, 64)
-	case MalBool:
-		if vv.Value {
-			return "true"
+		if p.opts.EDN || p.opts.Readably && (math.IsInf(vv.Value, 0) || math.IsNaN(vv.Value)) {
+			// ##Inf, ##-Inf and ##NaN read back as the same float
+			p.write(ednFloat(vv.Value))
 		} else {
-			return "false"
+			p.write(strconv.FormatFloat(vv.Value, 'f', -1, 64))
 		}
+	case MalBool:
+		p.write(strconv.FormatBool(vv.Value))
 	case MalFunc:
-		return "#<function>"
+		p.write(funcString(funcKind(vv.Macro), vv.Name, nil))
 	case MalTcoFunc:
-		return "#<function>"
+		p.write(funcString(funcKind(vv.Fn.Macro), vv.Fn.Name, vv.Params))
 	case MalString:
-		if vv.IsKeyword() {
-			return ":" + vv.AsKeyword()
-		}
-		if readably {
-			return "\"" + readableString(vv.Value) + "\""
+		if name, err := vv.AsKeyword(); err == nil {
+			p.write(":" + name)
+		} else if p.opts.Readably {
+			p.write("\"" + readableString(vv.Value) + "\"")
 		} else {
-			return vv.Value
+			p.write(vv.Value)
 		}
 	case MalList:
-		var str string
-
 		if vv.IsVector() {
-			str += "["
+			p.printSeq("[", vv.Values, "]")
 		} else {
-			str += "("
+			p.printSeq("(", vv.Values, ")")
 		}
+	case *MalLazySeq:
+		p.printSeq("(", p.lazyValues(vv), ")")
+	case *MalAtom:
+		p.printAtom(vv)
+	case *MalMap:
+		p.printMap(vv.Iter())
+	case *MalSortedMap:
+		p.printMap(vv.Entries())
+	case *MalSet:
+		p.printSeq("#{", vv.items(), "}")
+	case *MalSortedSet:
+		p.printSeq("#{", sortedItems(vv), "}")
+	case *MalError:
+		p.printError(vv)
+	case *MalRegex:
+		if p.opts.Readably {
+			p.write("#\"" + regexSource(vv) + "\"")
+		} else {
+			p.write(vv.Re.String())
+		}
+	case *MalReduced:
+		p.write("(reduced ")
+		p.print(vv.Value)
+		p.write(")")
+	case MalInst:
+		p.printTagged("inst", vv.String())
+	case MalUUID:
+		p.printTagged("uuid", vv.Value)
+	default:
+		if p.err == nil {
+			p.err = NewKindError(ErrKindType, fmt.Sprintf("cannot print a value of type %T", v))
+		}
+	}
+}
 
-		for i, value := range vv.Values {
-			if i != 0 {
-				str += " "
+// printTagged prints the tagged literal #tag "s", or s if not printing
+// readably.
+func (p *printer) printTagged(tag string, s string) {
+	if p.opts.Readably {
+		p.write("#" + tag + " \"" + s + "\"")
+	} else {
+		p.write(s)
+	}
+}
+
+// PrWrite writes the printed representation of v to w.
+func PrWrite(w io.Writer, v MalValue, opts PrintOptions) error {
+	p := newPrinter(w, opts)
+	p.print(v)
+	return p.err
+}
+
+func PrStr(v MalValue, readably bool) string {
+	return PrStrOpts(v, DefaultPrintOptions(readably))
+}
+
+func PrStrOpts(v MalValue, opts PrintOptions) string {
+	var sb strings.Builder
+	PrWrite(&sb, v, opts)
+	return sb.String()
+}
+
+// printValues writes each of values to w, separated by sep.
+func printValues(w io.Writer, values []MalValue, sep string, opts PrintOptions) error {
+	for i, v := range values {
+		if i > 0 {
+			if _, err := io.WriteString(w, sep); err != nil {
+				return err
 			}
-			str += PrStr(value, readably)
 		}
+		if err := PrWrite(w, v, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		if vv.IsVector() {
-			str += "]"
-		} else {
-			str += ")"
+// printStdout prints values to the standard output, followed by end.
+func printStdout(values []MalValue, sep string, end string, opts PrintOptions) error {
+	w := bufio.NewWriter(os.Stdout)
+	if err := printValues(w, values, sep, opts); err != nil {
+		return err
+	}
+	if _, err := w.WriteString(end); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// PrintNamespace returns the printing builtins, which read the
+// *print-length* and *print-level* settings from the current module of env,
+// as bound in the calling thread.
+// str builds strings rather than printing, so it ignores them.
+func PrintNamespace(env *Env) Namespace {
+	m := make(map[MalSymbol]MalFunc)
+
+	m[makeSymbol("prnn")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		return nil, printStdout(args, "", "", printOptionsFromEnv(t, t.CurrentEnv(), true))
+	})
+	m[makeSymbol("pr-str")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		var sb strings.Builder
+		if err := printValues(&sb, args, " ", printOptionsFromEnv(t, t.CurrentEnv(), true)); err != nil {
+			return nil, err
 		}
+		return MalString{Value: sb.String()}, nil
+	})
+	m[makeSymbol("str")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		var sb strings.Builder
+		if err := printValues(&sb, args, "", DefaultPrintOptions(false)); err != nil {
+			return nil, err
+		}
+		return MalString{Value: sb.String()}, nil
+	})
+	m[makeSymbol("prn")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		return nil, printStdout(args, " ", "\n", printOptionsFromEnv(t, t.CurrentEnv(), true))
+	})
+	m[makeSymbol("print")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		return nil, printStdout(args, " ", "", printOptionsFromEnv(t, t.CurrentEnv(), false))
+	})
+	m[makeSymbol("println")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		return nil, printStdout(args, " ", "\n", printOptionsFromEnv(t, t.CurrentEnv(), false))
+	})
 
-		return str
-	case *MalAtom:
-		var v MalValue
-		if vv.Ref != nil {
-			v = vv.Ref
+	pprintArgs := func(t *Thread, args []MalValue) (MalValue, int, error) {
+		if len(args) != 1 && len(args) != 2 {
+			return nil, 0, ErrWrongFuncNArgs
 		}
-		return "(atom " + PrStr(v, readably) + ")"
-	case *MalMap:
-		str := "{"
-		for i, kv := range vv.Iter() {
-			if i != 0 {
-				str += " "
+		width := printWidthFromEnv(t, t.CurrentEnv())
+		if len(args) == 2 {
+			w, ok := args[1].(MalInt)
+			if !ok {
+				return nil, 0, NewTypeError("MalInt", args[1])
 			}
-			str += PrStr(kv.Key, readably) + " " + PrStr(kv.Value, readably)
+			width = int(w.Value)
 		}
-		str += "}"
-		return str
+		return args[0], width, nil
 	}
+	m[makeSymbol("pprint")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		v, width, err := pprintArgs(t, args)
+		if err != nil {
+			return nil, err
+		}
+		w := bufio.NewWriter(os.Stdout)
+		if err := PprWrite(w, v, printOptionsFromEnv(t, t.CurrentEnv(), true), width); err != nil {
+			return nil, err
+		}
+		w.WriteString("\n")
+		return nil, w.Flush()
+	})
+	m[makeSymbol("pprint-str")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		v, width, err := pprintArgs(t, args)
+		if err != nil {
+			return nil, err
+		}
+		var sb strings.Builder
+		if err := PprWrite(&sb, v, printOptionsFromEnv(t, t.CurrentEnv(), true), width); err != nil {
+			return nil, err
+		}
+		return MalString{Value: sb.String()}, nil
+	})
 
-	panic("unreachable")
+	return Namespace{M: m}
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
@@ -9,15 +10,21 @@ import (
 
 var (
 	ErrReadNoToken = errors.New("no tokens read")
+	// ErrReadNoForm is returned by reader macros that read as nothing.
+	ErrReadNoForm = errors.New("no form read")
 )
 
 type Reader struct {
 	Tokens   []string
 	Position int
+
+	edn       *ednOptions // set when reading EDN data rather than code
+	fnLiteral bool        // set while reading the body of #(...)
+	host      string      // feature of reader conditionals, besides default
 }
 
 func NewReader(tokens []string) *Reader {
-	return &Reader{Tokens: tokens, Position: 0}
+	return &Reader{Tokens: tokens, Position: 0, host: strings.ToLower(HostLanguage)}
 }
 
 func (r *Reader) Next() (string, error) {
@@ -37,16 +44,59 @@ func (r *Reader) Peek() (string, error) {
 }
 
 func ReadStr(input string) (MalValue, error) {
-	tokens := Tokenize(input)
-	if len(tokens) == 0 {
+	return readFirst(NewReader(Tokenize(input)))
+}
+
+// readFirst reads the first form of r, or returns ErrReadNoToken if there
+// is none.
+func readFirst(r *Reader) (MalValue, error) {
+	form, ok, err := r.readNext()
+	if err != nil {
+		return nil, readError(err)
+	}
+	if !ok {
 		return nil, ErrReadNoToken
 	}
-	r := NewReader(tokens)
-	return r.ReadForm()
+	return form, nil
+}
+
+// readAll reads all the forms left in r.
+func readAll(r *Reader) ([]MalValue, error) {
+	forms := []MalValue{}
+	for {
+		form, ok, err := r.readNext()
+		if err != nil {
+			return nil, readError(err)
+		}
+		if !ok {
+			return forms, nil
+		}
+		forms = append(forms, form)
+	}
+}
+
+// readNext reads the next form, skipping the reader macros that read as
+// nothing, and reports false if there is none left.
+func (r *Reader) readNext() (MalValue, bool, error) {
+	for r.Position < len(r.Tokens) {
+		form, err := r.readForm()
+		if err != ErrReadNoForm {
+			return form, err == nil, err
+		}
+	}
+	return nil, false, nil
+}
+
+func readError(err error) error {
+	var malErr *MalError
+	if errors.As(err, &malErr) {
+		return err
+	}
+	return &MalError{kind: ErrKindRead, message: NewString(err.Error()), value: NewString(err.Error()), cause: err}
 }
 
 func Tokenize(input string) []string {
-	re := `[\s,]*(~@|[\[\]{}()'\x60~^@]|"(?:\\.|[^\\"])*"?|;.*|[^\s\[\]{}('"\x60,;)]*)`
+	re := `[\s,]*(~@|[\[\]{}()'\x60~^@]|#?"(?:\\.|[^\\"])*"?|;.*|[^\s\[\]{}('"\x60,;)]*)`
 	compiled := regexp.MustCompile(re)
 
 	rem := input
@@ -75,11 +125,49 @@ func Tokenize(input string) []string {
 	return tokens
 }
 
+// expandMeta expands the shorthands ^:key for ^{:key true} and ^tag for
+// ^{:tag tag}.
+func expandMeta(meta MalValue) MalValue {
+	switch v := meta.(type) {
+	case MalString:
+		m := NewMap()
+		if v.IsKeyword() {
+			m.Set(v, NewBool(true))
+		} else {
+			m.Set(NewKeyword("tag"), v)
+		}
+		return m
+	case MalSymbol:
+		m := NewMap()
+		m.Set(NewKeyword("tag"), v)
+		return m
+	default:
+		return meta
+	}
+}
+
+// ReadForm reads the next form, skipping the reader macros that read as
+// nothing.
 func (r *Reader) ReadForm() (MalValue, error) {
+	for {
+		form, err := r.readForm()
+		if err != ErrReadNoForm {
+			return form, err
+		}
+	}
+}
+
+func (r *Reader) readForm() (MalValue, error) {
 	peek, err := r.Peek()
 	if err != nil {
 		return nil, err
 	}
+	if r.edn != nil && (peek == "'" || peek == "`" || peek == "~" || peek == "~@" || peek == "@" || peek == "^" || strings.HasPrefix(peek, "#\"")) {
+		return nil, fmt.Errorf("unexpected %s in EDN", peek)
+	}
+	if strings.HasPrefix(peek, "#") && !strings.HasPrefix(peek, "#\"") {
+		return r.readDispatch()
+	}
 	if peek == "(" {
 		return r.ReadList(ListTypeList)
 	} else if peek == "[" {
@@ -96,8 +184,16 @@ func (r *Reader) ReadForm() (MalValue, error) {
 		if err != nil {
 			return nil, err
 		}
+		if sym, ok := form.(MalSymbol); ok {
+			// symbols are not evaluated to themselves, so they get their
+			// metadata as they are read
+			if m, ok := expandMeta(meta).(*MalMap); ok {
+				sym.Meta = m
+				return sym, nil
+			}
+		}
 		return NewList([]MalValue{
-			makeSymbol("with-meta"), form, meta,
+			makeSymbol("with-meta"), form, expandMeta(meta),
 		}), nil
 	} else if peek == "'" {
 		r.Next() // consume "'"
@@ -147,6 +243,7 @@ const (
 	ListTypeList listType = iota
 	ListTypeVector
 	ListTypeMap
+	ListTypeSet
 )
 
 func (r *Reader) ReadList(typ listType) (MalValue, error) {
@@ -172,19 +269,29 @@ func (r *Reader) ReadList(typ listType) (MalValue, error) {
 			break
 		}
 		if peek == "}" {
-			if typ != ListTypeMap {
+			if typ != ListTypeMap && typ != ListTypeSet {
 				return nil, errors.New("unexpected `}`")
 			}
 			r.Next() // consume "}"
 			break
 		}
-		form, err := r.ReadForm()
+		form, err := r.readForm()
+		if err == ErrReadNoForm {
+			continue
+		}
 		if err != nil {
 			return nil, err
 		}
 		values = append(values, form)
 	}
 
+	if r.edn != nil {
+		// EDN forbids what code literals silently merge
+		if err := checkDistinct(typ, values); err != nil {
+			return nil, err
+		}
+	}
+
 	switch typ {
 	case ListTypeList:
 		return NewList(values), nil
@@ -192,6 +299,8 @@ func (r *Reader) ReadList(typ listType) (MalValue, error) {
 		return NewVector(values), nil
 	case ListTypeMap:
 		return NewMapFromList(values)
+	case ListTypeSet:
+		return NewSet(values), nil
 	default:
 		panic("unknown list type")
 	}
@@ -204,16 +313,16 @@ func (r *Reader) ReadAtom() (MalValue, error) {
 	}
 	// if token[0] is a digit
 	if (token[0] >= '0' && token[0] <= '9') || (len(token) > 1 && token[0] == '-' && (token[1] >= '0' && token[1] <= '9')) {
-		if !strings.Contains(token, ".") {
+		if !strings.ContainsAny(token, ".eE") {
 			integer, err := strconv.ParseInt(token, 10, 64)
 			if err != nil {
-				panic(err)
+				return nil, fmt.Errorf("invalid number %q: %w", token, err)
 			}
 			return MalInt{Value: integer}, nil
 		} else {
 			float, err := strconv.ParseFloat(token, 64)
 			if err != nil {
-				panic(err)
+				return nil, fmt.Errorf("invalid number %q: %w", token, err)
 			}
 			return MalFloat{Value: float}, nil
 		}
@@ -226,6 +335,12 @@ func (r *Reader) ReadAtom() (MalValue, error) {
 	} else if token[0] == ':' {
 		substr := token[1:]
 		return NewKeyword(substr), nil
+	} else if strings.HasPrefix(token, "#\"") {
+		if len(token) == 2 || token[len(token)-1] != '"' {
+			return nil, errors.New("unexpected EOF")
+		}
+		// the pattern is taken as written, with no string escapes
+		return NewRegex(token[2 : len(token)-1])
 	} else if token[0] == '"' {
 		if len(token) == 1 {
 			return nil, errors.New("unexpected EOF")
@@ -245,34 +360,45 @@ func (r *Reader) ReadAtom() (MalValue, error) {
 }
 
 func readString(s string) (string, error) {
-	result := ""
-	backslash := false
-	for _, ch := range s {
-		if !backslash {
-			if ch == '\\' {
-				backslash = true
-			} else {
-				result += string(ch)
-			}
+	var sb strings.Builder
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '\\' {
+			sb.WriteRune(runes[i])
 			continue
 		}
-
-		switch ch {
+		i++
+		if i == len(runes) {
+			return "", errors.New("unexpected EOF")
+		}
+		switch ch := runes[i]; ch {
 		case '\\':
-			result += "\\"
+			sb.WriteByte('\\')
 		case 'n':
-			result += "\n"
+			sb.WriteByte('\n')
 		case '"':
-			result += "\""
+			sb.WriteByte('"')
+		case 't':
+			sb.WriteByte('\t')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'u':
+			if i+4 >= len(runes) {
+				return "", errors.New("unexpected EOF")
+			}
+			code, err := strconv.ParseUint(string(runes[i+1:i+5]), 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("invalid escape: \\u%s", string(runes[i+1:i+5]))
+			}
+			sb.WriteRune(rune(code))
+			i += 4
 		default:
-			panic("unsupported escape character")
+			return "", fmt.Errorf("unsupported escape character: \\%c", ch)
 		}
-		backslash = false
-	}
-
-	if backslash {
-		return "", errors.New("unexpected EOF")
 	}
-
-	return result, nil
+	return sb.String(), nil
 }
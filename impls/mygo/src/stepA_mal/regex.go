@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// MalRegex is a compiled regular expression, read from #"pattern" or made
+// by re-pattern. It uses the syntax of Go's regexp package.
+type MalRegex struct {
+	Re *regexp.Regexp
+
+	wholeOnce sync.Once
+	whole     *regexp.Regexp // Re anchored at both ends, compiled by re-matches
+}
+
+func (*MalRegex) MalValue() {}
+
+func NewRegex(pattern string) (*MalRegex, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %w", err)
+	}
+	return &MalRegex{Re: re}, nil
+}
+
+// matchWhole returns the submatch indices of re if it matches all of s.
+func (r *MalRegex) matchWhole(s string) []int {
+	r.wholeOnce.Do(func() {
+		r.whole = regexp.MustCompile(`^(?:` + r.Re.String() + `)\z`)
+	})
+	return r.whole.FindStringSubmatchIndex(s)
+}
+
+// regexSource returns the pattern of r as written in a #"..." literal, in
+// which double quotes must be escaped.
+func regexSource(r *MalRegex) string {
+	var sb strings.Builder
+	backslash := false
+	for _, c := range r.Re.String() {
+		if c == '"' && !backslash {
+			sb.WriteRune('\\')
+		}
+		backslash = c == '\\' && !backslash
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+func regexArg(v MalValue) (*MalRegex, error) {
+	r, ok := v.(*MalRegex)
+	if !ok {
+		return nil, NewTypeError("regex", v)
+	}
+	return r, nil
+}
+
+// matchValue returns the match of re in s at the submatch indices loc:
+// the matched string if re has no groups, and otherwise a vector of the
+// match followed by the groups, nil for those that did not participate.
+func matchValue(re *regexp.Regexp, s string, loc []int) MalValue {
+	if re.NumSubexp() == 0 {
+		return NewString(s[loc[0]:loc[1]])
+	}
+	groups := make([]MalValue, len(loc)/2)
+	for i := range groups {
+		if loc[2*i] >= 0 {
+			groups[i] = NewString(s[loc[2*i]:loc[2*i+1]])
+		}
+	}
+	return NewVector(groups)
+}
+
+// namedGroups returns a map of the named groups of re to their match at
+// the submatch indices loc.
+func namedGroups(re *regexp.Regexp, s string, loc []int) *MalMap {
+	m := NewMap()
+	for i, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		var v MalValue
+		if loc[2*i] >= 0 {
+			v = NewString(s[loc[2*i]:loc[2*i+1]])
+		}
+		m.Set(NewKeyword(name), v)
+	}
+	return m
+}
+
+// regexSplit splits s around the matches of re, removing trailing empty
+// strings unless limit is positive, as split does for strings.
+func regexSplit(re *regexp.Regexp, s string, limit int64) []string {
+	if limit > 0 {
+		return re.Split(s, int(limit))
+	}
+	if !re.MatchString(s) {
+		return []string{s}
+	}
+	parts := re.Split(s, -1)
+	for len(parts) > 0 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	return parts
+}
+
+// regexReplace replaces the matches of re in s by replacement, a string
+// in which $1 or ${name} stand for groups, or a function called on each
+// match as returned by re-find.
+func regexReplace(t *Thread, re *regexp.Regexp, s string, replacement MalValue) (MalValue, error) {
+	if f, ok := replacement.(MalInvoke); ok {
+		var sb strings.Builder
+		last := 0
+		for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+			r, err := f.Invoke(t, []MalValue{matchValue(re, s, loc)})
+			if err != nil {
+				return nil, err
+			}
+			rs, err := stringArg(r)
+			if err != nil {
+				return nil, err
+			}
+			sb.WriteString(s[last:loc[0]])
+			sb.WriteString(rs)
+			last = loc[1]
+		}
+		sb.WriteString(s[last:])
+		return NewString(sb.String()), nil
+	}
+	template, err := stringArg(replacement)
+	if err != nil {
+		return nil, err
+	}
+	return NewString(re.ReplaceAllString(s, template)), nil
+}
+
+// RegexNamespace returns the builtins making and matching regexes.
+func RegexNamespace() Namespace {
+	m := make(map[MalSymbol]MalFunc)
+
+	// matchFn makes a builtin of a regex and a string, which calls f with
+	// the submatch indices found by find, or returns nil if there are none.
+	matchFn := func(find func(r *MalRegex, s string) []int, f func(r *MalRegex, s string, loc []int) MalValue) MalFunc {
+		return makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+			if len(args) != 2 {
+				return nil, ErrWrongFuncNArgs
+			}
+			r, err := regexArg(args[0])
+			if err != nil {
+				return nil, err
+			}
+			s, err := stringArg(args[1])
+			if err != nil {
+				return nil, err
+			}
+			loc := find(r, s)
+			if loc == nil {
+				return nil, nil
+			}
+			return f(r, s, loc), nil
+		})
+	}
+	find := func(r *MalRegex, s string) []int {
+		return r.Re.FindStringSubmatchIndex(s)
+	}
+	match := func(r *MalRegex, s string, loc []int) MalValue {
+		return matchValue(r.Re, s, loc)
+	}
+
+	m[makeSymbol("re-pattern")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		if r, ok := args[0].(*MalRegex); ok {
+			return r, nil
+		}
+		s, err := stringArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return NewRegex(s)
+	})
+	m[makeSymbol("re-find")] = matchFn(find, match)
+	m[makeSymbol("re-matches")] = matchFn((*MalRegex).matchWhole, match)
+	m[makeSymbol("re-groups")] = matchFn(find, func(r *MalRegex, s string, loc []int) MalValue {
+		return namedGroups(r.Re, s, loc)
+	})
+	m[makeSymbol("re-seq")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 2 {
+			return nil, ErrWrongFuncNArgs
+		}
+		r, err := regexArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		s, err := stringArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		matches := []MalValue{}
+		for _, loc := range r.Re.FindAllStringSubmatchIndex(s, -1) {
+			matches = append(matches, matchValue(r.Re, s, loc))
+		}
+		if len(matches) == 0 {
+			return nil, nil
+		}
+		return NewList(matches), nil
+	})
+	m[makeSymbol("regex?")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		_, ok := args[0].(*MalRegex)
+		return NewBool(ok), nil
+	})
+
+	return Namespace{M: m}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestConcurrentMatchWhole(t *testing.T) {
+	r, err := NewRegex(`\d+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var done sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			if r.matchWhole("123") == nil {
+				t.Error(`\d+ does not match all of "123"`)
+			}
+		}()
+	}
+	done.Wait()
+}
@@ -0,0 +1,793 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// lazyIf returns s as it is if any of colls is a lazy sequence, and
+// otherwise realized as a list, so that functions on finite collections
+// run their arguments eagerly.
+func lazyIf(s *MalLazySeq, colls ...MalValue) (MalValue, error) {
+	for _, c := range colls {
+		if _, ok := c.(*MalLazySeq); ok {
+			return s, nil
+		}
+	}
+	values, err := seqValues(s)
+	if err != nil {
+		return nil, err
+	}
+	return NewList(values), nil
+}
+
+// forEach calls f on the elements of v in order until f returns false.
+func forEach(v MalValue, f func(x MalValue) (bool, error)) error {
+	_, err := reduceOf(v, func(_ MalValue, x MalValue) (MalValue, error) {
+		more, err := f(x)
+		if err != nil || more {
+			return nil, err
+		}
+		return &MalReduced{}, nil
+	}, nil)
+	return err
+}
+
+func funcArg(v MalValue) (MalInvoke, error) {
+	f, ok := v.(MalInvoke)
+	if !ok {
+		return nil, NewTypeError("MalFunc", v)
+	}
+	return f, nil
+}
+
+// mapSeq returns the results of f on the first elements of colls, then on
+// the second ones, and so on until one of colls is exhausted.
+func mapSeq(t *Thread, f MalInvoke, colls []MalValue) *MalLazySeq {
+	return NewLazySeq(func() (MalValue, error) {
+		args := make([]MalValue, len(colls))
+		rests := make([]MalValue, len(colls))
+		for i, c := range colls {
+			first, rest, ok, err := uncons(c)
+			if err != nil || !ok {
+				return nil, err
+			}
+			args[i], rests[i] = first, rest
+		}
+		y, err := f.Invoke(t, args)
+		if err != nil {
+			return nil, err
+		}
+		return newSeqCell(y, mapSeq(t, f, rests)), nil
+	})
+}
+
+// filterSeq returns the elements of v for which pred is truthy if keep is
+// true, or falsy otherwise.
+func filterSeq(t *Thread, pred MalInvoke, v MalValue, keep bool) *MalLazySeq {
+	return NewLazySeq(func() (MalValue, error) {
+		for {
+			if err := checkInterrupt(); err != nil {
+				return nil, err
+			}
+			first, rest, ok, err := uncons(v)
+			if err != nil || !ok {
+				return nil, err
+			}
+			r, err := pred.Invoke(t, []MalValue{first})
+			if err != nil {
+				return nil, err
+			}
+			if isTruthy(r) == keep {
+				return newSeqCell(first, filterSeq(t, pred, rest, keep)), nil
+			}
+			v = rest
+		}
+	})
+}
+
+// partitionSeq returns lists of n elements of v, starting every step
+// elements. If padded, the last list is completed from pad and may be
+// shorter than n; otherwise an incomplete last list is dropped.
+func partitionSeq(n, step int64, pad MalValue, padded bool, v MalValue) *MalLazySeq {
+	return NewLazySeq(func() (MalValue, error) {
+		part, err := seqPrefix(v, int(n))
+		if err != nil || len(part) == 0 {
+			return nil, err
+		}
+		if int64(len(part)) < n {
+			if !padded {
+				return nil, nil
+			}
+			padding, err := seqPrefix(pad, int(n)-len(part))
+			if err != nil {
+				return nil, err
+			}
+			return NewList([]MalValue{NewList(append(part, padding...))}), nil
+		}
+		return newSeqCell(NewList(part), partitionSeq(n, step, pad, padded, dropSeq(step, v))), nil
+	})
+}
+
+// distinctSeq returns the elements of v that are not in seen, adding them
+// to seen as they are returned.
+func distinctSeq(v MalValue, seen *MalMap) *MalLazySeq {
+	return NewLazySeq(func() (MalValue, error) {
+		for {
+			if err := checkInterrupt(); err != nil {
+				return nil, err
+			}
+			first, rest, ok, err := uncons(v)
+			if err != nil || !ok {
+				return nil, err
+			}
+			if _, dup := seen.Get(first); !dup {
+				seen.Set(first, MalBool{Value: true})
+				return newSeqCell(first, distinctSeq(rest, seen)), nil
+			}
+			v = rest
+		}
+	})
+}
+
+func interleaveSeq(colls []MalValue) *MalLazySeq {
+	return NewLazySeq(func() (MalValue, error) {
+		firsts := make([]MalValue, len(colls))
+		rests := make([]MalValue, len(colls))
+		for i, c := range colls {
+			first, rest, ok, err := uncons(c)
+			if err != nil || !ok {
+				return nil, err
+			}
+			firsts[i], rests[i] = first, rest
+		}
+		var s MalValue = interleaveSeq(rests)
+		for i := len(firsts) - 1; i >= 0; i-- {
+			s = newSeqCell(firsts[i], s)
+		}
+		return s, nil
+	})
+}
+
+// typeRank orders the types of values for compareValues.
+func typeRank(v MalValue) int {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case MalBool:
+		return 1
+	case MalInt, MalFloat:
+		return 2
+	case MalString:
+		if v.IsKeyword() {
+			return 4
+		}
+		return 3
+	case MalSymbol:
+		return 5
+	case MalList, *MalLazySeq:
+		return 6
+	case *MalSet, *MalSortedSet:
+		return 7
+	case *MalMap, *MalSortedMap:
+		return 8
+	case MalInst:
+		return 9
+	case MalUUID:
+		return 10
+	default:
+		return 11
+	}
+}
+
+// compareValues orders any two values, returning a negative number, zero
+// or a positive number as a is less than, equal to or greater than b.
+// Values of different types are ordered by type: nil, booleans, numbers,
+// strings, keywords, symbols, lists and vectors, sets, maps, instants and
+// UUIDs. Within a type, false is less than true, numbers compare by value
+// and an integer is less than an equal float, strings, keywords, symbols
+// and UUIDs by their names, lists, vectors and sets by size and then
+// element by element, maps by size and then by their keys and values in
+// key order, and instants by time. Two values compare as zero only if
+// they are =. NaN, which is not = to itself, and other values, such as
+// functions and atoms, have no order and comparing them is a type error.
+func compareValues(a, b MalValue) (int, error) {
+	if ra, rb := typeRank(a), typeRank(b); ra != rb {
+		return compareInts(ra, rb), nil
+	}
+	switch a := a.(type) {
+	case nil:
+		return 0, nil
+	case MalBool:
+		switch {
+		case a.Value == b.(MalBool).Value:
+			return 0, nil
+		case a.Value:
+			return 1, nil
+		default:
+			return -1, nil
+		}
+	case MalInt, MalFloat:
+		if isNaN(a) || isNaN(b) {
+			return 0, noOrder(a, b)
+		}
+		if less, err := numLess(a, b); err != nil || less {
+			return -1, err
+		}
+		if less, err := numLess(b, a); err != nil || less {
+			return 1, err
+		}
+		_, aInt := a.(MalInt)
+		_, bInt := b.(MalInt)
+		switch {
+		case aInt && !bInt:
+			return -1, nil
+		case !aInt && bInt:
+			return 1, nil
+		}
+		return 0, nil
+	case MalString:
+		return compareStrings(a.Value, b.(MalString).Value), nil
+	case MalSymbol:
+		return compareStrings(a.Value, b.(MalSymbol).Value), nil
+	case MalList, *MalLazySeq:
+		as, err := seqValues(a)
+		if err != nil {
+			return 0, err
+		}
+		bs, err := seqValues(b)
+		if err != nil {
+			return 0, err
+		}
+		return compareSeqs(as, bs)
+	case *MalSet, *MalSortedSet:
+		return compareSets(a, b)
+	case *MalMap, *MalSortedMap:
+		as, err := keysAndValues(a)
+		if err != nil {
+			return 0, err
+		}
+		bs, err := keysAndValues(b)
+		if err != nil {
+			return 0, err
+		}
+		return compareSeqs(as, bs)
+	case MalInst:
+		bt := b.(MalInst).Time
+		switch {
+		case a.Time.Before(bt):
+			return -1, nil
+		case a.Time.After(bt):
+			return 1, nil
+		default:
+			return 0, nil
+		}
+	case MalUUID:
+		return compareStrings(a.Value, b.(MalUUID).Value), nil
+	default:
+		return 0, noOrder(a, b)
+	}
+}
+
+// noOrder is the error of comparing a and b, which have no order.
+func noOrder(a, b MalValue) error {
+	return NewKindError(ErrKindType, fmt.Sprintf("cannot compare %s and %s", PrStr(a, true), PrStr(b, true)))
+}
+
+func isNaN(v MalValue) bool {
+	f, ok := v.(MalFloat)
+	return ok && math.IsNaN(f.Value)
+}
+
+// compareSets orders the sets a and b as the sequences of their elements,
+// which are sorted with compare unless both sets are already sorted.
+func compareSets(a, b MalValue) (int, error) {
+	as, _ := setItems(a)
+	bs, _ := setItems(b)
+	_, aSorted := a.(*MalSortedSet)
+	_, bSorted := b.(*MalSortedSet)
+	if !aSorted || !bSorted {
+		for _, items := range [][]MalValue{as, bs} {
+			keys := append([]MalValue{}, items...)
+			if err := sortValues(items, keys, compareValues); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return compareSeqs(as, bs)
+}
+
+// compareSeqs orders as and bs by length, and then element by element.
+func compareSeqs(as, bs []MalValue) (int, error) {
+	if len(as) != len(bs) {
+		return compareInts(len(as), len(bs)), nil
+	}
+	for i := range as {
+		c, err := compareValues(as[i], bs[i])
+		if err != nil || c != 0 {
+			return c, err
+		}
+	}
+	return 0, nil
+}
+
+// keysAndValues returns the keys and values of the map m, alternating, in
+// the order of compareValues on the keys.
+func keysAndValues(m MalValue) ([]MalValue, error) {
+	entries, _ := mapEntries(m)
+	tree := sortedTree{cmp: compareValues}
+	for _, kv := range entries {
+		var err error
+		if tree, err = tree.with(kv.Key, kv.Value); err != nil {
+			return nil, err
+		}
+	}
+	kvs := make([]MalValue, 0, 2*len(entries))
+	walk(tree.root, func(n *rbNode) (bool, error) {
+		kvs = append(kvs, n.key, n.value)
+		return true, nil
+	})
+	return kvs, nil
+}
+
+func compareStrings(a, b string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// comparator returns the ordering given by f, which returns a number like
+// compare or is a predicate like <.
+func comparator(t *Thread, f MalInvoke) func(a, b MalValue) (int, error) {
+	return func(a, b MalValue) (int, error) {
+		r, err := f.Invoke(t, []MalValue{a, b})
+		if err != nil {
+			return 0, err
+		}
+		switch r := r.(type) {
+		case MalInt:
+			return compareInts(int(r.Value), 0), nil
+		case MalFloat:
+			return compareValues(r, MalInt{Value: 0})
+		}
+		if isTruthy(r) {
+			return -1, nil
+		}
+		r, err = f.Invoke(t, []MalValue{b, a})
+		if err != nil || !isTruthy(r) {
+			return 0, err
+		}
+		return 1, nil
+	}
+}
+
+// sortValues stably sorts values in place by the keys at the same indices.
+func sortValues(values []MalValue, keys []MalValue, cmp func(a, b MalValue) (int, error)) error {
+	var err error
+	sort.Stable(byKeys{values, keys, func(a, b MalValue) bool {
+		if err != nil {
+			return false
+		}
+		var c int
+		c, err = cmp(a, b)
+		return c < 0
+	}})
+	return err
+}
+
+type byKeys struct {
+	values []MalValue
+	keys   []MalValue
+	less   func(a, b MalValue) bool
+}
+
+func (s byKeys) Len() int           { return len(s.values) }
+func (s byKeys) Less(i, j int) bool { return s.less(s.keys[i], s.keys[j]) }
+func (s byKeys) Swap(i, j int) {
+	s.values[i], s.values[j] = s.values[j], s.values[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+// sortArgs returns the comparator and the collection of (sort coll) and
+// (sort cmp coll), or of sort-by after its key function.
+func sortArgs(t *Thread, args []MalValue) (func(a, b MalValue) (int, error), MalValue, error) {
+	switch len(args) {
+	case 1:
+		return compareValues, args[0], nil
+	case 2:
+		f, err := funcArg(args[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		return comparator(t, f), args[1], nil
+	default:
+		return nil, nil, ErrWrongFuncNArgs
+	}
+}
+
+// assocIn returns v with the value at the path ks replaced by f of the
+// current value, creating maps for missing keys.
+func assocIn(v MalValue, ks []MalValue, f func(old MalValue) (MalValue, error)) (MalValue, error) {
+	old, _ := getOf(v, ks[0])
+	var inner MalValue
+	var err error
+	if len(ks) == 1 {
+		inner, err = f(old)
+	} else {
+		inner, err = assocIn(old, ks[1:], f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return assocOf(v, ks[0], inner)
+}
+
+// SeqNamespace returns the builtins of the sequence library.
+func SeqNamespace() Namespace {
+	m := make(map[MalSymbol]MalFunc)
+
+	m[makeSymbol("reduce")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 2 && len(args) != 3 {
+			return nil, ErrWrongFuncNArgs
+		}
+		f, err := funcArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		coll := args[len(args)-1]
+		var init MalValue
+		if len(args) == 3 {
+			init = args[1]
+		} else {
+			first, rest, ok, err := uncons(coll)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return f.Invoke(t, []MalValue{})
+			}
+			init, coll = first, rest
+		}
+		return reduceOf(coll, invokeRf(t, f), init)
+	})
+	m[makeSymbol("filter")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 && len(args) != 2 {
+			return nil, ErrWrongFuncNArgs
+		}
+		pred, err := funcArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 1 {
+			return filterXf(pred, true), nil
+		}
+		return lazyIf(filterSeq(t, pred, args[1], true), args[1])
+	})
+	m[makeSymbol("remove")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 && len(args) != 2 {
+			return nil, ErrWrongFuncNArgs
+		}
+		pred, err := funcArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 1 {
+			return filterXf(pred, false), nil
+		}
+		return lazyIf(filterSeq(t, pred, args[1], false), args[1])
+	})
+	m[makeSymbol("some")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 2 {
+			return nil, ErrWrongFuncNArgs
+		}
+		pred, err := funcArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		var result MalValue
+		err = forEach(args[1], func(x MalValue) (bool, error) {
+			r, err := pred.Invoke(t, []MalValue{x})
+			if err != nil {
+				return false, err
+			}
+			if isTruthy(r) {
+				result = r
+				return false, nil
+			}
+			return true, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	})
+	m[makeSymbol("every?")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 2 {
+			return nil, ErrWrongFuncNArgs
+		}
+		pred, err := funcArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		all := true
+		err = forEach(args[1], func(x MalValue) (bool, error) {
+			r, err := pred.Invoke(t, []MalValue{x})
+			all = isTruthy(r)
+			return all, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return NewBool(all), nil
+	})
+	m[makeSymbol("partition")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) < 2 || len(args) > 4 {
+			return nil, ErrWrongFuncNArgs
+		}
+		n, err := intArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		step := n
+		if len(args) >= 3 {
+			if step, err = intArg(args[1]); err != nil {
+				return nil, err
+			}
+		}
+		coll := args[len(args)-1]
+		var pad MalValue
+		if len(args) == 4 {
+			pad = args[2]
+		}
+		return lazyIf(partitionSeq(n, step, pad, len(args) == 4, coll), coll)
+	})
+	m[makeSymbol("group-by")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 2 {
+			return nil, ErrWrongFuncNArgs
+		}
+		f, err := funcArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		groups := NewMap()
+		err = forEach(args[1], func(x MalValue) (bool, error) {
+			k, err := f.Invoke(t, []MalValue{x})
+			if err != nil {
+				return false, err
+			}
+			group, _ := groups.Get(k)
+			var values []MalValue
+			if group != nil {
+				values = group.(MalList).Values
+			}
+			groups.Set(k, NewVector(append(values, x)))
+			return true, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return groups, nil
+	})
+	m[makeSymbol("frequencies")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		counts := NewMap()
+		err := forEach(args[0], func(x MalValue) (bool, error) {
+			n, _ := counts.Get(x)
+			if n == nil {
+				n = MalInt{Value: 0}
+			}
+			counts.Set(x, MalInt{Value: n.(MalInt).Value + 1})
+			return true, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return counts, nil
+	})
+	m[makeSymbol("distinct")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		switch len(args) {
+		case 0:
+			return distinctXf(), nil
+		case 1:
+		default:
+			return nil, ErrWrongFuncNArgs
+		}
+		return lazyIf(distinctSeq(args[0], NewMap()), args[0])
+	})
+	m[makeSymbol("sort")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		cmp, coll, err := sortArgs(t, args)
+		if err != nil {
+			return nil, err
+		}
+		values, err := seqValues(coll)
+		if err != nil {
+			return nil, err
+		}
+		values = append([]MalValue{}, values...)
+		keys := append([]MalValue{}, values...)
+		if err := sortValues(values, keys, cmp); err != nil {
+			return nil, err
+		}
+		return NewList(values), nil
+	})
+	m[makeSymbol("sort-by")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) < 2 {
+			return nil, ErrWrongFuncNArgs
+		}
+		keyFn, err := funcArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		cmp, coll, err := sortArgs(t, args[1:])
+		if err != nil {
+			return nil, err
+		}
+		values, err := seqValues(coll)
+		if err != nil {
+			return nil, err
+		}
+		values = append([]MalValue{}, values...)
+		keys := make([]MalValue, len(values))
+		for i, v := range values {
+			if keys[i], err = keyFn.Invoke(t, []MalValue{v}); err != nil {
+				return nil, err
+			}
+		}
+		if err := sortValues(values, keys, cmp); err != nil {
+			return nil, err
+		}
+		return NewList(values), nil
+	})
+	m[makeSymbol("reverse")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		values, err := seqValues(args[0])
+		if err != nil {
+			return nil, err
+		}
+		reversed := make([]MalValue, len(values))
+		for i, v := range values {
+			reversed[len(values)-1-i] = v
+		}
+		return NewList(reversed), nil
+	})
+	m[makeSymbol("interleave")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) == 0 {
+			return NewList([]MalValue{}), nil
+		}
+		return lazyIf(interleaveSeq(args), args...)
+	})
+	m[makeSymbol("zipmap")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 2 {
+			return nil, ErrWrongFuncNArgs
+		}
+		result := NewMap()
+		ks, vs := args[0], args[1]
+		for {
+			if err := checkInterrupt(); err != nil {
+				return nil, err
+			}
+			k, ksRest, ok, err := uncons(ks)
+			if err != nil || !ok {
+				return result, err
+			}
+			v, vsRest, ok, err := uncons(vs)
+			if err != nil || !ok {
+				return result, err
+			}
+			result.Set(k, v)
+			ks, vs = ksRest, vsRest
+		}
+	})
+	m[makeSymbol("merge")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		var result MalValue
+		for _, arg := range args {
+			if arg == nil {
+				continue
+			}
+			if result == nil {
+				if !isMap(arg) {
+					return nil, NewTypeError("MalMap", arg)
+				}
+				result = arg
+				continue
+			}
+			var err error
+			if result, err = conjOf(result, []MalValue{arg}); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	})
+	m[makeSymbol("update")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) < 3 {
+			return nil, fmt.Errorf("%w: expected at least 3 arguments, got %d", ErrWrongFuncNArgs, len(args))
+		}
+		f, err := funcArg(args[2])
+		if err != nil {
+			return nil, err
+		}
+		return assocIn(args[0], args[1:2], func(old MalValue) (MalValue, error) {
+			return f.Invoke(t, append([]MalValue{old}, args[3:]...))
+		})
+	})
+	m[makeSymbol("get-in")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 2 && len(args) != 3 {
+			return nil, ErrWrongFuncNArgs
+		}
+		ks, err := seqValues(args[1])
+		if err != nil {
+			return nil, err
+		}
+		v := args[0]
+		for _, k := range ks {
+			var ok bool
+			if v, ok = getOf(v, k); !ok {
+				if len(args) == 3 {
+					return args[2], nil
+				}
+				return nil, nil
+			}
+		}
+		return v, nil
+	})
+	m[makeSymbol("assoc-in")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 3 {
+			return nil, ErrWrongFuncNArgs
+		}
+		ks, err := seqValues(args[1])
+		if err != nil {
+			return nil, err
+		}
+		if len(ks) == 0 {
+			// as in Clojure, an empty path sets the value at the key nil
+			ks = []MalValue{nil}
+		}
+		return assocIn(args[0], ks, func(MalValue) (MalValue, error) {
+			return args[2], nil
+		})
+	})
+	m[makeSymbol("update-in")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) < 3 {
+			return nil, fmt.Errorf("%w: expected at least 3 arguments, got %d", ErrWrongFuncNArgs, len(args))
+		}
+		ks, err := seqValues(args[1])
+		if err != nil {
+			return nil, err
+		}
+		f, err := funcArg(args[2])
+		if err != nil {
+			return nil, err
+		}
+		update := func(old MalValue) (MalValue, error) {
+			return f.Invoke(t, append([]MalValue{old}, args[3:]...))
+		}
+		if len(ks) == 0 {
+			// as in Clojure, an empty path updates the value at the key nil
+			ks = []MalValue{nil}
+		}
+		return assocIn(args[0], ks, update)
+	})
+
+	return Namespace{M: m}
+}
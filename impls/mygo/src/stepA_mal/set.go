@@ -0,0 +1,112 @@
+package main
+
+// MalSet is a set read from a #{...} literal. Its elements are compared
+// with =, so that it holds values without an order, such as atoms and
+// functions, and are kept in insertion order, like the entries of MalMap.
+type MalSet struct {
+	values []MalValue
+	meta   MalValue
+}
+
+func (*MalSet) MalValue() {}
+
+// NewSet returns the set of xs, keeping the first of equal elements.
+func NewSet(xs []MalValue) *MalSet {
+	return (&MalSet{}).Conj(xs)
+}
+
+func (s *MalSet) Seq() (MalValue, error) {
+	if len(s.values) == 0 {
+		return nil, nil
+	}
+	return NewList(s.items()), nil
+}
+
+func (s *MalSet) Count() int {
+	return len(s.values)
+}
+
+func (s *MalSet) Reduce(f reduceFn, acc MalValue) (MalValue, error) {
+	for _, x := range s.values {
+		var done bool
+		var err error
+		if acc, done, err = reduceStep(f, acc, x); done {
+			return acc, err
+		}
+	}
+	return acc, nil
+}
+
+// Get returns the element of s equal to x, as get does on sets.
+func (s *MalSet) Get(x MalValue) (MalValue, bool) {
+	for _, v := range s.values {
+		if malEq(v, x) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func (s *MalSet) Conj(xs []MalValue) *MalSet {
+	result := &MalSet{values: s.items(), meta: s.meta}
+	for _, x := range xs {
+		if _, ok := result.Get(x); !ok {
+			result.values = append(result.values, x)
+		}
+	}
+	return result
+}
+
+func (s *MalSet) Disj(xs []MalValue) *MalSet {
+	result := &MalSet{values: []MalValue{}, meta: s.meta}
+	for _, v := range s.values {
+		removed := false
+		for _, x := range xs {
+			if malEq(v, x) {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			result.values = append(result.values, v)
+		}
+	}
+	return result
+}
+
+// items returns a copy of the elements of s.
+func (s *MalSet) items() []MalValue {
+	items := make([]MalValue, len(s.values))
+	copy(items, s.values)
+	return items
+}
+
+func (s *MalSet) GetMeta() MalValue {
+	return s.meta
+}
+
+func (s *MalSet) WithMeta(meta MalValue) MalValue {
+	return &MalSet{values: s.values, meta: meta}
+}
+
+// isSet reports whether v is a set, sorted or not.
+func isSet(v MalValue) bool {
+	switch v.(type) {
+	case *MalSet, *MalSortedSet:
+		return true
+	default:
+		return false
+	}
+}
+
+// setItems returns the elements of v if it is a set.
+func setItems(v MalValue) ([]MalValue, bool) {
+	switch s := v.(type) {
+	case *MalSet:
+		return s.items(), true
+	case *MalSortedSet:
+		return sortedItems(s), true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,719 @@
+package main
+
+// rbNode is a node of a persistent left-leaning red-black tree. A node
+// reachable from a tree is never changed: updates copy the nodes on the
+// path from the root, so older versions of the tree stay valid.
+type rbNode struct {
+	key, value  MalValue
+	left, right *rbNode
+	red         bool
+}
+
+func isRed(n *rbNode) bool {
+	return n != nil && n.red
+}
+
+func (n *rbNode) clone() *rbNode {
+	c := *n
+	return &c
+}
+
+// The balancing helpers below follow Sedgewick's left-leaning red-black
+// trees. They change the node h given to them, which must be a copy
+// private to the update in progress, and copy the children they change.
+
+func rotateLeft(h *rbNode) *rbNode {
+	x := h.right.clone()
+	h.right = x.left
+	x.left = h
+	x.red = h.red
+	h.red = true
+	return x
+}
+
+func rotateRight(h *rbNode) *rbNode {
+	x := h.left.clone()
+	h.left = x.right
+	x.right = h
+	x.red = h.red
+	h.red = true
+	return x
+}
+
+func flipColors(h *rbNode) {
+	h.red = !h.red
+	h.left = h.left.clone()
+	h.left.red = !h.left.red
+	h.right = h.right.clone()
+	h.right.red = !h.right.red
+}
+
+func balance(h *rbNode) *rbNode {
+	if isRed(h.right) && !isRed(h.left) {
+		h = rotateLeft(h)
+	}
+	if isRed(h.left) && isRed(h.left.left) {
+		h = rotateRight(h)
+	}
+	if isRed(h.left) && isRed(h.right) {
+		flipColors(h)
+	}
+	return h
+}
+
+func moveRedLeft(h *rbNode) *rbNode {
+	flipColors(h)
+	if isRed(h.right.left) {
+		h.right = rotateRight(h.right)
+		h = rotateLeft(h)
+		flipColors(h)
+	}
+	return h
+}
+
+func moveRedRight(h *rbNode) *rbNode {
+	flipColors(h)
+	if isRed(h.left.left) {
+		h = rotateRight(h)
+		flipColors(h)
+	}
+	return h
+}
+
+func deleteMin(h *rbNode) *rbNode {
+	if h.left == nil {
+		return nil
+	}
+	h = h.clone()
+	if !isRed(h.left) && !isRed(h.left.left) {
+		h = moveRedLeft(h)
+	}
+	h.left = deleteMin(h.left)
+	return balance(h)
+}
+
+// sortedTree is a persistent red-black tree ordered by cmp. Its methods
+// return new trees and leave the receiver unchanged.
+type sortedTree struct {
+	root  *rbNode
+	count int
+	cmp   func(a, b MalValue) (int, error)
+}
+
+// find returns the node of key, or nil.
+func (t sortedTree) find(key MalValue) (*rbNode, error) {
+	n := t.root
+	for n != nil {
+		c, err := t.cmp(key, n.key)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case c < 0:
+			n = n.left
+		case c > 0:
+			n = n.right
+		default:
+			return n, nil
+		}
+	}
+	return nil, nil
+}
+
+// with returns t with key mapped to value. An existing key keeps its
+// place and gets the new value.
+func (t sortedTree) with(key MalValue, value MalValue) (sortedTree, error) {
+	root, added, err := t.insert(t.root, key, value)
+	if err != nil {
+		return t, err
+	}
+	if root.red {
+		root = root.clone()
+		root.red = false
+	}
+	if added {
+		t.count++
+	}
+	t.root = root
+	return t, nil
+}
+
+func (t sortedTree) insert(h *rbNode, key MalValue, value MalValue) (*rbNode, bool, error) {
+	if h == nil {
+		return &rbNode{key: key, value: value, red: true}, true, nil
+	}
+	c, err := t.cmp(key, h.key)
+	if err != nil {
+		return nil, false, err
+	}
+	h = h.clone()
+	added := false
+	switch {
+	case c < 0:
+		h.left, added, err = t.insert(h.left, key, value)
+	case c > 0:
+		h.right, added, err = t.insert(h.right, key, value)
+	default:
+		h.value = value
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return balance(h), added, nil
+}
+
+// without returns t without key.
+func (t sortedTree) without(key MalValue) (sortedTree, error) {
+	n, err := t.find(key)
+	if err != nil || n == nil {
+		return t, err
+	}
+	root := t.root.clone()
+	if !isRed(root.left) && !isRed(root.right) {
+		root.red = true
+	}
+	if root, err = t.delete(root, key); err != nil {
+		return t, err
+	}
+	if root != nil && root.red {
+		root = root.clone()
+		root.red = false
+	}
+	t.root = root
+	t.count--
+	return t, nil
+}
+
+// delete removes key, which must be in the subtree h, from a copy of h.
+func (t sortedTree) delete(h *rbNode, key MalValue) (*rbNode, error) {
+	h = h.clone()
+	c, err := t.cmp(key, h.key)
+	if err != nil {
+		return nil, err
+	}
+	if c < 0 {
+		if !isRed(h.left) && !isRed(h.left.left) {
+			h = moveRedLeft(h)
+		}
+		if h.left, err = t.delete(h.left, key); err != nil {
+			return nil, err
+		}
+		return balance(h), nil
+	}
+	if isRed(h.left) {
+		h = rotateRight(h)
+		if c, err = t.cmp(key, h.key); err != nil {
+			return nil, err
+		}
+	}
+	if c == 0 && h.right == nil {
+		return nil, nil
+	}
+	if !isRed(h.right) && !isRed(h.right.left) {
+		h = moveRedRight(h)
+		if c, err = t.cmp(key, h.key); err != nil {
+			return nil, err
+		}
+	}
+	if c == 0 {
+		min := h.right
+		for min.left != nil {
+			min = min.left
+		}
+		h.key, h.value = min.key, min.value
+		h.right = deleteMin(h.right)
+	} else if h.right, err = t.delete(h.right, key); err != nil {
+		return nil, err
+	}
+	return balance(h), nil
+}
+
+// walk calls f on the nodes of the subtree n in order, until f returns
+// false.
+func walk(n *rbNode, f func(n *rbNode) (bool, error)) (bool, error) {
+	if n == nil {
+		return true, nil
+	}
+	if more, err := walk(n.left, f); !more || err != nil {
+		return false, err
+	}
+	if more, err := f(n); !more || err != nil {
+		return false, err
+	}
+	return walk(n.right, f)
+}
+
+// between appends to nodes the nodes of the subtree n, in order, whose
+// keys pass both low and high. low must hold for all keys above one that
+// passes it, and high for all keys below one that passes it.
+func between(n *rbNode, low, high func(k MalValue) (bool, error), nodes []*rbNode) ([]*rbNode, error) {
+	if n == nil {
+		return nodes, nil
+	}
+	aboveLow, err := low(n.key)
+	if err != nil {
+		return nil, err
+	}
+	belowHigh, err := high(n.key)
+	if err != nil {
+		return nil, err
+	}
+	if aboveLow {
+		if nodes, err = between(n.left, low, high, nodes); err != nil {
+			return nil, err
+		}
+	}
+	if aboveLow && belowHigh {
+		nodes = append(nodes, n)
+	}
+	if belowHigh {
+		return between(n.right, low, high, nodes)
+	}
+	return nodes, nil
+}
+
+// sortedColl is implemented by the sorted collections, whose elements
+// are the nodes of a tree.
+type sortedColl interface {
+	MalValue
+	sorted() sortedTree
+	item(n *rbNode) MalValue
+}
+
+func sortedItems(c sortedColl) []MalValue {
+	items := make([]MalValue, 0, c.sorted().count)
+	walk(c.sorted().root, func(n *rbNode) (bool, error) {
+		items = append(items, c.item(n))
+		return true, nil
+	})
+	return items
+}
+
+func sortedReduce(c sortedColl, f reduceFn, acc MalValue) (MalValue, error) {
+	_, err := walk(c.sorted().root, func(n *rbNode) (bool, error) {
+		var done bool
+		var err error
+		acc, done, err = reduceStep(f, acc, c.item(n))
+		return !done, err
+	})
+	return acc, err
+}
+
+func sortedSeq(c sortedColl) (MalValue, error) {
+	if c.sorted().count == 0 {
+		return nil, nil
+	}
+	return NewList(sortedItems(c)), nil
+}
+
+// MalSortedMap is a map whose entries are ordered by their keys, with
+// compare or the comparator given to sorted-map-by.
+type MalSortedMap struct {
+	tree sortedTree
+	meta MalValue
+}
+
+func (*MalSortedMap) MalValue() {}
+
+func (m *MalSortedMap) sorted() sortedTree {
+	return m.tree
+}
+
+func (m *MalSortedMap) item(n *rbNode) MalValue {
+	return NewVector([]MalValue{n.key, n.value})
+}
+
+func (m *MalSortedMap) Seq() (MalValue, error) {
+	return sortedSeq(m)
+}
+
+func (m *MalSortedMap) Count() int {
+	return m.tree.count
+}
+
+func (m *MalSortedMap) Reduce(f reduceFn, acc MalValue) (MalValue, error) {
+	return sortedReduce(m, f, acc)
+}
+
+// Get looks up key in m. A key that the comparator of m fails on is
+// not found.
+func (m *MalSortedMap) Get(key MalValue) (MalValue, bool) {
+	n, err := m.tree.find(key)
+	if err != nil || n == nil {
+		return nil, false
+	}
+	return n.value, true
+}
+
+func (m *MalSortedMap) Assoc(key MalValue, value MalValue) (MalValue, error) {
+	tree, err := m.tree.with(key, value)
+	if err != nil {
+		return nil, err
+	}
+	return &MalSortedMap{tree: tree, meta: m.meta}, nil
+}
+
+func (m *MalSortedMap) Dissoc(keys []MalValue) (*MalSortedMap, error) {
+	tree := m.tree
+	for _, k := range keys {
+		var err error
+		if tree, err = tree.without(k); err != nil {
+			return nil, err
+		}
+	}
+	return &MalSortedMap{tree: tree, meta: m.meta}, nil
+}
+
+// Conj adds to m each of xs, a [key value] vector or a map.
+func (m *MalSortedMap) Conj(xs []MalValue) (*MalSortedMap, error) {
+	tree := m.tree
+	for _, x := range xs {
+		var entries []MalMapEntry
+		if l, ok := x.(MalList); ok && l.IsVector() && len(l.Values) == 2 {
+			entries = []MalMapEntry{{Key: l.Values[0], Value: l.Values[1]}}
+		} else if entries, ok = mapEntries(x); !ok {
+			return nil, NewTypeError("map entry", x)
+		}
+		for _, kv := range entries {
+			var err error
+			if tree, err = tree.with(kv.Key, kv.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &MalSortedMap{tree: tree, meta: m.meta}, nil
+}
+
+// Entries returns the entries of m in key order.
+func (m *MalSortedMap) Entries() []MalMapEntry {
+	entries := make([]MalMapEntry, 0, m.tree.count)
+	walk(m.tree.root, func(n *rbNode) (bool, error) {
+		entries = append(entries, MalMapEntry{Key: n.key, Value: n.value})
+		return true, nil
+	})
+	return entries
+}
+
+func (m *MalSortedMap) GetMeta() MalValue {
+	return m.meta
+}
+
+func (m *MalSortedMap) WithMeta(meta MalValue) MalValue {
+	return &MalSortedMap{tree: m.tree, meta: meta}
+}
+
+// MalSortedSet is a set whose elements are ordered by compare or the
+// comparator given to sorted-set-by.
+type MalSortedSet struct {
+	tree sortedTree
+	meta MalValue
+}
+
+func (*MalSortedSet) MalValue() {}
+
+func (s *MalSortedSet) sorted() sortedTree {
+	return s.tree
+}
+
+func (s *MalSortedSet) item(n *rbNode) MalValue {
+	return n.key
+}
+
+func (s *MalSortedSet) Seq() (MalValue, error) {
+	return sortedSeq(s)
+}
+
+func (s *MalSortedSet) Count() int {
+	return s.tree.count
+}
+
+func (s *MalSortedSet) Reduce(f reduceFn, acc MalValue) (MalValue, error) {
+	return sortedReduce(s, f, acc)
+}
+
+// Get returns the element of s equal to x, as get does on sets.
+func (s *MalSortedSet) Get(x MalValue) (MalValue, bool) {
+	n, err := s.tree.find(x)
+	if err != nil || n == nil {
+		return nil, false
+	}
+	return n.key, true
+}
+
+func (s *MalSortedSet) Conj(xs []MalValue) (*MalSortedSet, error) {
+	tree := s.tree
+	for _, x := range xs {
+		var err error
+		if tree, err = tree.with(x, x); err != nil {
+			return nil, err
+		}
+	}
+	return &MalSortedSet{tree: tree, meta: s.meta}, nil
+}
+
+func (s *MalSortedSet) Disj(xs []MalValue) (*MalSortedSet, error) {
+	tree := s.tree
+	for _, x := range xs {
+		var err error
+		if tree, err = tree.without(x); err != nil {
+			return nil, err
+		}
+	}
+	return &MalSortedSet{tree: tree, meta: s.meta}, nil
+}
+
+func (s *MalSortedSet) GetMeta() MalValue {
+	return s.meta
+}
+
+func (s *MalSortedSet) WithMeta(meta MalValue) MalValue {
+	return &MalSortedSet{tree: s.tree, meta: meta}
+}
+
+// isMap reports whether v is a map, sorted or not.
+func isMap(v MalValue) bool {
+	switch v.(type) {
+	case *MalMap, *MalSortedMap:
+		return true
+	default:
+		return false
+	}
+}
+
+// mapEntries returns the entries of v if it is a map, sorted or not.
+func mapEntries(v MalValue) ([]MalMapEntry, bool) {
+	switch m := v.(type) {
+	case *MalMap:
+		return m.Iter(), true
+	case *MalSortedMap:
+		return m.Entries(), true
+	default:
+		return nil, false
+	}
+}
+
+// mapEq reports whether the maps a and b have equal entries.
+func mapEq(a MalValue, b MalValue) (bool, error) {
+	if !isMap(b) {
+		return false, nil
+	}
+	entries, _ := mapEntries(a)
+	if n, _ := countOf(b); n != len(entries) {
+		return false, nil
+	}
+	for _, kv := range entries {
+		v, ok := getOf(b, kv.Key)
+		if !ok {
+			return false, nil
+		}
+		if eq, err := malEqual(kv.Value, v); !eq || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// setEq reports whether the sets a and b have equal elements.
+func setEq(a MalValue, b MalValue) (bool, error) {
+	if !isSet(b) {
+		return false, nil
+	}
+	items, _ := setItems(a)
+	if n, _ := countOf(b); n != len(items) {
+		return false, nil
+	}
+	for _, x := range items {
+		y, ok := getOf(b, x)
+		if !ok {
+			return false, nil
+		}
+		if eq, err := malEqual(x, y); !eq || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// sortedCmp returns compare, or the comparator made from the function f
+// for the -by variants.
+func sortedCmp(t *Thread, f MalValue) (func(a, b MalValue) (int, error), error) {
+	if f == nil {
+		return compareValues, nil
+	}
+	fn, err := funcArg(f)
+	if err != nil {
+		return nil, err
+	}
+	return comparator(t, fn), nil
+}
+
+// boundTest returns the test of a key k against a bound of subseq, which
+// is (test (compare k key) 0).
+func boundTest(t *Thread, tree sortedTree, test MalInvoke, key MalValue) func(k MalValue) (bool, error) {
+	return func(k MalValue) (bool, error) {
+		c, err := tree.cmp(k, key)
+		if err != nil {
+			return false, err
+		}
+		r, err := test.Invoke(t, []MalValue{MalInt{Value: int64(c)}, MalInt{Value: 0}})
+		return isTruthy(r), err
+	}
+}
+
+// subseq returns the items of sc within the bounds given by args, which
+// are test and key, or start-test, start-key, end-test and end-key.
+func subseq(t *Thread, args []MalValue) ([]MalValue, error) {
+	if len(args) != 3 && len(args) != 5 {
+		return nil, ErrWrongFuncNArgs
+	}
+	sc, ok := args[0].(sortedColl)
+	if !ok {
+		return nil, NewTypeError("sorted collection", args[0])
+	}
+	tree := sc.sorted()
+	tests := []func(k MalValue) (bool, error){}
+	for i := 1; i < len(args); i += 2 {
+		test, err := funcArg(args[i])
+		if err != nil {
+			return nil, err
+		}
+		tests = append(tests, boundTest(t, tree, test, args[i+1]))
+	}
+	always := func(k MalValue) (bool, error) {
+		return true, nil
+	}
+	low, high := tests[0], always
+	if len(tests) == 2 {
+		high = tests[1]
+	} else {
+		// a single test is an upper bound, like < or <=, if it rejects
+		// keys above its key
+		above, err := funcArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		r, err := above.Invoke(t, []MalValue{MalInt{Value: 1}, MalInt{Value: 0}})
+		if err != nil {
+			return nil, err
+		}
+		if !isTruthy(r) {
+			low, high = always, tests[0]
+		}
+	}
+	nodes, err := between(tree.root, low, high, nil)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]MalValue, len(nodes))
+	for i, n := range nodes {
+		items[i] = sc.item(n)
+	}
+	return items, nil
+}
+
+// SortedNamespace returns the builtins of the ordering of values and the
+// sorted collections.
+func SortedNamespace() Namespace {
+	m := make(map[MalSymbol]MalFunc)
+
+	sortedMap := func(t *Thread, cmp MalValue, kvs []MalValue) (MalValue, error) {
+		if len(kvs)%2 != 0 {
+			return nil, NewKindError(ErrKindArity, "sorted-map expects an even number of arguments")
+		}
+		f, err := sortedCmp(t, cmp)
+		if err != nil {
+			return nil, err
+		}
+		tree := sortedTree{cmp: f}
+		for i := 0; i < len(kvs); i += 2 {
+			if tree, err = tree.with(kvs[i], kvs[i+1]); err != nil {
+				return nil, err
+			}
+		}
+		return &MalSortedMap{tree: tree}, nil
+	}
+	sortedSet := func(t *Thread, cmp MalValue, xs []MalValue) (MalValue, error) {
+		f, err := sortedCmp(t, cmp)
+		if err != nil {
+			return nil, err
+		}
+		return (&MalSortedSet{tree: sortedTree{cmp: f}}).Conj(xs)
+	}
+
+	m[makeSymbol("compare")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 2 {
+			return nil, ErrWrongFuncNArgs
+		}
+		c, err := compareValues(args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+		return MalInt{Value: int64(c)}, nil
+	})
+	m[makeSymbol("sorted-map")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		return sortedMap(t, nil, args)
+	})
+	m[makeSymbol("sorted-map-by")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) < 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		return sortedMap(t, args[0], args[1:])
+	})
+	m[makeSymbol("sorted-set")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		return sortedSet(t, nil, args)
+	})
+	m[makeSymbol("sorted-set-by")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) < 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		return sortedSet(t, args[0], args[1:])
+	})
+	m[makeSymbol("sorted?")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		_, ok := args[0].(sortedColl)
+		return NewBool(ok), nil
+	})
+	m[makeSymbol("set?")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		return NewBool(isSet(args[0])), nil
+	})
+	m[makeSymbol("disj")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) < 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		if args[0] == nil {
+			return nil, nil
+		}
+		switch s := args[0].(type) {
+		case *MalSet:
+			return s.Disj(args[1:]), nil
+		case *MalSortedSet:
+			return s.Disj(args[1:])
+		default:
+			return nil, NewTypeError("set", args[0])
+		}
+	})
+	m[makeSymbol("subseq")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		items, err := subseq(t, args)
+		if err != nil || len(items) == 0 {
+			return nil, err
+		}
+		return NewList(items), nil
+	})
+	m[makeSymbol("rsubseq")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		items, err := subseq(t, args)
+		if err != nil || len(items) == 0 {
+			return nil, err
+		}
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+		return NewList(items), nil
+	})
+
+	return Namespace{M: m}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// StringModuleName is the name of the module of the string builtins,
+// which are called as string/join or through an alias.
+const StringModuleName = "string"
+
+func stringArg(v MalValue) (string, error) {
+	s, ok := v.(MalString)
+	if !ok || s.IsKeyword() {
+		return "", NewTypeError("MalString", v)
+	}
+	return s.Value, nil
+}
+
+// stringArgs checks that args are n strings followed by optional ones.
+func stringArgs(args []MalValue, n int) ([]string, error) {
+	if len(args) < n {
+		return nil, ErrWrongFuncNArgs
+	}
+	strs := make([]string, n)
+	for i := range strs {
+		s, err := stringArg(args[i])
+		if err != nil {
+			return nil, err
+		}
+		strs[i] = s
+	}
+	return strs, nil
+}
+
+// runeIndex returns the byte offset of the rune at index i of s, which
+// may be the rune count of s.
+func runeIndex(s string, i int64) (int, error) {
+	if i < 0 {
+		return 0, NewKindError(ErrKindIndex, fmt.Sprintf("index out of range: %d", i))
+	}
+	n := int64(0)
+	for offset := range s {
+		if n == i {
+			return offset, nil
+		}
+		n++
+	}
+	if n == i {
+		return len(s), nil
+	}
+	return 0, NewKindError(ErrKindIndex, fmt.Sprintf("index out of range: %d", i))
+}
+
+func stringList(strs []string) MalList {
+	values := make([]MalValue, len(strs))
+	for i, s := range strs {
+		values[i] = NewString(s)
+	}
+	return NewVector(values)
+}
+
+// split splits s around sep. Without a limit, trailing empty strings are
+// removed unless sep does not occur at all, as in Clojure.
+func split(s string, sep string, limit int64) []string {
+	if limit > 0 {
+		return strings.SplitN(s, sep, int(limit))
+	}
+	if !strings.Contains(s, sep) {
+		return []string{s}
+	}
+	parts := strings.Split(s, sep)
+	for len(parts) > 0 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	return parts
+}
+
+// pad pads s with fill to width runes, on the given side.
+func pad(s string, width int, side string, fill string) (string, error) {
+	missing := width - utf8.RuneCountInString(s)
+	if missing <= 0 {
+		return s, nil
+	}
+	if utf8.RuneCountInString(fill) != 1 {
+		return "", NewKindError(ErrKindType, fmt.Sprintf("pad fill must be one character, got %q", fill))
+	}
+	switch side {
+	case "left":
+		return strings.Repeat(fill, missing) + s, nil
+	case "right":
+		return s + strings.Repeat(fill, missing), nil
+	case "center":
+		left := missing / 2
+		return strings.Repeat(fill, left) + s + strings.Repeat(fill, missing-left), nil
+	default:
+		return "", NewKindError(ErrKindType, fmt.Sprintf("pad side must be :left, :right or :center, got :%s", side))
+	}
+}
+
+// StringNamespace returns the builtins of the string module. Indices and
+// lengths count runes rather than bytes.
+func StringNamespace() Namespace {
+	m := make(map[MalSymbol]MalFunc)
+
+	// stringFn makes a builtin of one string argument
+	stringFn := func(f func(s string) MalValue) MalFunc {
+		return makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+			if len(args) != 1 {
+				return nil, ErrWrongFuncNArgs
+			}
+			s, err := stringArg(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return f(s), nil
+		})
+	}
+	// stringPred makes a builtin testing a string against another
+	stringPred := func(f func(s, x string) bool) MalFunc {
+		return makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+			if len(args) != 2 {
+				return nil, ErrWrongFuncNArgs
+			}
+			strs, err := stringArgs(args, 2)
+			if err != nil {
+				return nil, err
+			}
+			return NewBool(f(strs[0], strs[1])), nil
+		})
+	}
+
+	m[makeSymbol("split")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 2 && len(args) != 3 {
+			return nil, ErrWrongFuncNArgs
+		}
+		s, err := stringArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		limit := int64(0)
+		if len(args) == 3 {
+			if limit, err = intArg(args[2]); err != nil {
+				return nil, err
+			}
+		}
+		if r, ok := args[1].(*MalRegex); ok {
+			return stringList(regexSplit(r.Re, s, limit)), nil
+		}
+		sep, err := stringArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return stringList(split(s, sep, limit)), nil
+	})
+	m[makeSymbol("split-lines")] = stringFn(func(s string) MalValue {
+		lines := split(s, "\n", 0)
+		for i, line := range lines {
+			lines[i] = strings.TrimSuffix(line, "\r")
+		}
+		return stringList(lines)
+	})
+	m[makeSymbol("join")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 && len(args) != 2 {
+			return nil, ErrWrongFuncNArgs
+		}
+		sep := ""
+		if len(args) == 2 {
+			var err error
+			if sep, err = stringArg(args[0]); err != nil {
+				return nil, err
+			}
+		}
+		values, err := seqValues(args[len(args)-1])
+		if err != nil {
+			return nil, err
+		}
+		var sb strings.Builder
+		if err := printValues(&sb, values, sep, DefaultPrintOptions(false)); err != nil {
+			return nil, err
+		}
+		return NewString(sb.String()), nil
+	})
+	m[makeSymbol("trim")] = stringFn(func(s string) MalValue {
+		return NewString(strings.TrimSpace(s))
+	})
+	m[makeSymbol("triml")] = stringFn(func(s string) MalValue {
+		return NewString(strings.TrimLeftFunc(s, unicode.IsSpace))
+	})
+	m[makeSymbol("trimr")] = stringFn(func(s string) MalValue {
+		return NewString(strings.TrimRightFunc(s, unicode.IsSpace))
+	})
+	m[makeSymbol("upper-case")] = stringFn(func(s string) MalValue {
+		return NewString(strings.ToUpper(s))
+	})
+	m[makeSymbol("lower-case")] = stringFn(func(s string) MalValue {
+		return NewString(strings.ToLower(s))
+	})
+	m[makeSymbol("reverse")] = stringFn(func(s string) MalValue {
+		runes := []rune(s)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return NewString(string(runes))
+	})
+	m[makeSymbol("starts-with?")] = stringPred(strings.HasPrefix)
+	m[makeSymbol("ends-with?")] = stringPred(strings.HasSuffix)
+	m[makeSymbol("includes?")] = stringPred(strings.Contains)
+	m[makeSymbol("index-of")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 2 && len(args) != 3 {
+			return nil, ErrWrongFuncNArgs
+		}
+		strs, err := stringArgs(args, 2)
+		if err != nil {
+			return nil, err
+		}
+		s, x := strs[0], strs[1]
+		from := int64(0)
+		if len(args) == 3 {
+			if from, err = intArg(args[2]); err != nil {
+				return nil, err
+			}
+		}
+		start, err := runeIndex(s, from)
+		if err != nil {
+			return nil, nil
+		}
+		i := strings.Index(s[start:], x)
+		if i < 0 {
+			return nil, nil
+		}
+		return MalInt{Value: from + int64(utf8.RuneCountInString(s[start:start+i]))}, nil
+	})
+	m[makeSymbol("replace")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 3 {
+			return nil, ErrWrongFuncNArgs
+		}
+		s, err := stringArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if r, ok := args[1].(*MalRegex); ok {
+			return regexReplace(t, r.Re, s, args[2])
+		}
+		strs, err := stringArgs(args[1:], 2)
+		if err != nil {
+			return nil, err
+		}
+		return NewString(strings.ReplaceAll(s, strs[0], strs[1])), nil
+	})
+	m[makeSymbol("subs")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 2 && len(args) != 3 {
+			return nil, ErrWrongFuncNArgs
+		}
+		s, err := stringArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		start, err := intArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		end := int64(utf8.RuneCountInString(s))
+		if len(args) == 3 {
+			if end, err = intArg(args[2]); err != nil {
+				return nil, err
+			}
+		}
+		if end < start {
+			return nil, NewKindError(ErrKindIndex, fmt.Sprintf("index out of range: %d", end))
+		}
+		i, err := runeIndex(s, start)
+		if err != nil {
+			return nil, err
+		}
+		j, err := runeIndex(s, end)
+		if err != nil {
+			return nil, err
+		}
+		return NewString(s[i:j]), nil
+	})
+	m[makeSymbol("pad")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) < 2 || len(args) > 4 {
+			return nil, ErrWrongFuncNArgs
+		}
+		s, err := stringArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		width, err := intArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		side, fill := "right", " "
+		if len(args) >= 3 {
+			kw, _ := args[2].(MalString)
+			var err error
+			if side, err = kw.AsKeyword(); err != nil {
+				return nil, NewTypeError("keyword", args[2])
+			}
+		}
+		if len(args) == 4 {
+			if fill, err = stringArg(args[3]); err != nil {
+				return nil, err
+			}
+		}
+		padded, err := pad(s, int(width), side, fill)
+		if err != nil {
+			return nil, err
+		}
+		return NewString(padded), nil
+	})
+
+	return Namespace{M: m}
+}
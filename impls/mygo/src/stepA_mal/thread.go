@@ -0,0 +1,39 @@
+package main
+
+// Thread is the state of the evaluation in one goroutine: the current
+// module, the eval calls and requires in progress and their dynamic scope,
+// made of the condition handlers, restarts, caught errors and dynamic var
+// bindings established by the enclosing forms. A Thread is passed down eval and to every function
+// called, so that goroutines evaluating in the same interpreter never see
+// each other's dynamic scope. Values that call mal code later, such as
+// lazy sequences, call it in the Thread that made them.
+type Thread struct {
+	state   *EvalState
+	current *Module  // module in which top-level forms are evaluated
+	loading []string // modules being loaded by require, innermost last
+
+	calls    []string           // function applied by each active eval call, if any
+	handlers [][]handlerBinding // clusters established by handler-bind, innermost last
+	restarts []*restart         // restarts established by restart-case, innermost last
+	caught   []*MalError        // errors handled by the enclosing catch* clauses, innermost last
+	bindings bindings           // values of dynamic vars bound by binding
+}
+
+// NewThread returns a thread evaluating in the user module of the
+// interpreter of state, with an empty dynamic scope.
+func NewThread(state *EvalState) *Thread {
+	return &Thread{state: state, current: state.module("user")}
+}
+
+// Fork returns a thread for another goroutine, starting in the current
+// module of t and with its dynamic var bindings, as a concurrency
+// primitive conveys them.
+func (t *Thread) Fork() *Thread {
+	return &Thread{state: t.state, current: t.current, bindings: t.bindings}
+}
+
+// CurrentEnv returns the environment of the current module of t, in which
+// top-level forms are evaluated.
+func (t *Thread) CurrentEnv() *Env {
+	return t.current.Env
+}
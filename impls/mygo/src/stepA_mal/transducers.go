@@ -0,0 +1,422 @@
+package main
+
+// MalReduced wraps the result of a reduction that should stop early.
+type MalReduced struct {
+	Value MalValue
+}
+
+func (*MalReduced) MalValue() {}
+
+func ensureReduced(v MalValue) MalValue {
+	if _, ok := v.(*MalReduced); ok {
+		return v
+	}
+	return &MalReduced{Value: v}
+}
+
+// invokeRf returns the step of the reducing function rf.
+func invokeRf(t *Thread, rf MalInvoke) reduceFn {
+	return func(acc MalValue, x MalValue) (MalValue, error) {
+		return rf.Invoke(t, []MalValue{acc, x})
+	}
+}
+
+// reducingFn returns a reducing function wrapping rf. Called with no
+// arguments it returns (rf), with a result it completes it with
+// (rf result), and with a result and an input it calls step.
+func reducingFn(rf MalInvoke, step reduceFn) MalFunc {
+	return makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		switch len(args) {
+		case 0, 1:
+			return rf.Invoke(t, args)
+		case 2:
+			return step(args[0], args[1])
+		default:
+			return nil, ErrWrongFuncNArgs
+		}
+	})
+}
+
+// transducer returns the function transforming a reducing function rf
+// into the one made by xf. xf is called once per reduction, in the thread
+// of the reduction, so the state of stateful transducers lives in its
+// closure.
+func transducer(xf func(t *Thread, rf MalInvoke) MalFunc) MalFunc {
+	return makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		rf, err := funcArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return xf(t, rf), nil
+	})
+}
+
+// mapXf calls f on each input, or on the inputs of each step when
+// transducing several collections.
+func mapXf(f MalInvoke) MalFunc {
+	return transducer(func(t *Thread, rf MalInvoke) MalFunc {
+		return makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+			if len(args) < 2 {
+				return rf.Invoke(t, args)
+			}
+			y, err := f.Invoke(t, args[1:])
+			if err != nil {
+				return nil, err
+			}
+			return rf.Invoke(t, []MalValue{args[0], y})
+		})
+	})
+}
+
+func filterXf(pred MalInvoke, keep bool) MalFunc {
+	return transducer(func(t *Thread, rf MalInvoke) MalFunc {
+		return reducingFn(rf, func(acc MalValue, x MalValue) (MalValue, error) {
+			r, err := pred.Invoke(t, []MalValue{x})
+			if err != nil || isTruthy(r) != keep {
+				return acc, err
+			}
+			return rf.Invoke(t, []MalValue{acc, x})
+		})
+	})
+}
+
+func takeXf(n int64) MalFunc {
+	return transducer(func(t *Thread, rf MalInvoke) MalFunc {
+		left := n
+		return reducingFn(rf, func(acc MalValue, x MalValue) (MalValue, error) {
+			if left > 0 {
+				left--
+				var err error
+				if acc, err = rf.Invoke(t, []MalValue{acc, x}); err != nil {
+					return nil, err
+				}
+			}
+			if left <= 0 {
+				return ensureReduced(acc), nil
+			}
+			return acc, nil
+		})
+	})
+}
+
+func dropXf(n int64) MalFunc {
+	return transducer(func(t *Thread, rf MalInvoke) MalFunc {
+		left := n
+		return reducingFn(rf, func(acc MalValue, x MalValue) (MalValue, error) {
+			if left > 0 {
+				left--
+				return acc, nil
+			}
+			return rf.Invoke(t, []MalValue{acc, x})
+		})
+	})
+}
+
+func takeWhileXf(pred MalInvoke) MalFunc {
+	return transducer(func(t *Thread, rf MalInvoke) MalFunc {
+		return reducingFn(rf, func(acc MalValue, x MalValue) (MalValue, error) {
+			r, err := pred.Invoke(t, []MalValue{x})
+			if err != nil {
+				return nil, err
+			}
+			if !isTruthy(r) {
+				return &MalReduced{Value: acc}, nil
+			}
+			return rf.Invoke(t, []MalValue{acc, x})
+		})
+	})
+}
+
+func distinctXf() MalFunc {
+	return transducer(func(t *Thread, rf MalInvoke) MalFunc {
+		seen := NewMap()
+		return reducingFn(rf, func(acc MalValue, x MalValue) (MalValue, error) {
+			if _, dup := seen.Get(x); dup {
+				return acc, nil
+			}
+			seen.Set(x, MalBool{Value: true})
+			return rf.Invoke(t, []MalValue{acc, x})
+		})
+	})
+}
+
+// catXf reduces each input collection into rf. A reduced result is
+// wrapped again so that it survives the inner reduce and stops the
+// outer one too.
+func catXf() MalFunc {
+	return transducer(func(t *Thread, rf MalInvoke) MalFunc {
+		step := invokeRf(t, rf)
+		return reducingFn(rf, func(acc MalValue, coll MalValue) (MalValue, error) {
+			return reduceOf(coll, func(acc MalValue, x MalValue) (MalValue, error) {
+				r, err := step(acc, x)
+				if _, ok := r.(*MalReduced); ok {
+					return &MalReduced{Value: r}, err
+				}
+				return r, err
+			}, acc)
+		})
+	})
+}
+
+// appendRf returns a reducing function adding its inputs to items and
+// ignoring its result.
+func appendRf(items *[]MalValue) MalFunc {
+	return makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		switch len(args) {
+		case 0:
+			return nil, nil
+		case 1:
+			return args[0], nil
+		case 2:
+			*items = append(*items, args[1])
+			return args[0], nil
+		default:
+			return nil, ErrWrongFuncNArgs
+		}
+	})
+}
+
+// transduceValues returns the outputs of the transducer xf over coll.
+func transduceValues(t *Thread, xf MalInvoke, coll MalValue) ([]MalValue, error) {
+	items := []MalValue{}
+	r, err := xf.Invoke(t, []MalValue{appendRf(&items)})
+	if err != nil {
+		return nil, err
+	}
+	rf, err := funcArg(r)
+	if err != nil {
+		return nil, err
+	}
+	acc, err := reduceOf(coll, invokeRf(t, rf), nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rf.Invoke(t, []MalValue{acc}); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// xfState runs a transducer over src step by step for sequence. The
+// outputs of each step are buffered in buf until they are consumed.
+type xfState struct {
+	t    *Thread
+	rf   MalInvoke
+	buf  []MalValue
+	src  MalValue
+	done bool
+}
+
+func (s *xfState) seq() *MalLazySeq {
+	return NewLazySeq(func() (MalValue, error) {
+		for len(s.buf) == 0 {
+			if s.done {
+				return nil, nil
+			}
+			if err := checkInterrupt(); err != nil {
+				return nil, err
+			}
+			first, rest, ok, err := uncons(s.src)
+			if err != nil {
+				return nil, err
+			}
+			stop := !ok
+			if ok {
+				s.src = rest
+				r, err := s.rf.Invoke(s.t, []MalValue{nil, first})
+				if err != nil {
+					return nil, err
+				}
+				_, stop = r.(*MalReduced)
+			}
+			if stop {
+				// the source is exhausted or the transducer stopped, so
+				// completion may flush some more outputs
+				s.done = true
+				if _, err := s.rf.Invoke(s.t, []MalValue{nil}); err != nil {
+					return nil, err
+				}
+			}
+		}
+		x := s.buf[0]
+		s.buf = s.buf[1:]
+		return newSeqCell(x, s.seq()), nil
+	})
+}
+
+func xfSeq(t *Thread, xf MalInvoke, coll MalValue) (*MalLazySeq, error) {
+	s := &xfState{t: t, src: coll}
+	r, err := xf.Invoke(t, []MalValue{appendRf(&s.buf)})
+	if err != nil {
+		return nil, err
+	}
+	if s.rf, err = funcArg(r); err != nil {
+		return nil, err
+	}
+	return s.seq(), nil
+}
+
+// TransducerNamespace returns the builtins composing and running
+// transducers.
+func TransducerNamespace() Namespace {
+	m := make(map[MalSymbol]MalFunc)
+
+	m[makeSymbol("reduced")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		return &MalReduced{Value: args[0]}, nil
+	})
+	m[makeSymbol("reduced?")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		_, ok := args[0].(*MalReduced)
+		return NewBool(ok), nil
+	})
+	m[makeSymbol("unreduced")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		if r, ok := args[0].(*MalReduced); ok {
+			return r.Value, nil
+		}
+		return args[0], nil
+	})
+	m[makeSymbol("cat")] = catXf()
+	m[makeSymbol("identity")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 {
+			return nil, ErrWrongFuncNArgs
+		}
+		return args[0], nil
+	})
+	m[makeSymbol("comp")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		fs := make([]MalInvoke, len(args))
+		for i, arg := range args {
+			f, err := funcArg(arg)
+			if err != nil {
+				return nil, err
+			}
+			fs[i] = f
+		}
+		return makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+			if len(fs) == 0 {
+				if len(args) != 1 {
+					return nil, ErrWrongFuncNArgs
+				}
+				return args[0], nil
+			}
+			r, err := fs[len(fs)-1].Invoke(t, args)
+			for i := len(fs) - 2; i >= 0 && err == nil; i-- {
+				r, err = fs[i].Invoke(t, []MalValue{r})
+			}
+			return r, err
+		}), nil
+	})
+	m[makeSymbol("completing")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 1 && len(args) != 2 {
+			return nil, ErrWrongFuncNArgs
+		}
+		f, err := funcArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		var cf MalInvoke
+		if len(args) == 2 {
+			if cf, err = funcArg(args[1]); err != nil {
+				return nil, err
+			}
+		}
+		return makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+			if len(args) != 1 {
+				return f.Invoke(t, args)
+			}
+			if cf == nil {
+				return args[0], nil
+			}
+			return cf.Invoke(t, args)
+		}), nil
+	})
+	m[makeSymbol("transduce")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		if len(args) != 3 && len(args) != 4 {
+			return nil, ErrWrongFuncNArgs
+		}
+		xf, err := funcArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		f, err := funcArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		r, err := xf.Invoke(t, []MalValue{args[1]})
+		if err != nil {
+			return nil, err
+		}
+		rf, err := funcArg(r)
+		if err != nil {
+			return nil, err
+		}
+		var init MalValue
+		if len(args) == 4 {
+			init = args[2]
+		} else if init, err = f.Invoke(t, []MalValue{}); err != nil {
+			return nil, err
+		}
+		acc, err := reduceOf(args[len(args)-1], invokeRf(t, rf), init)
+		if err != nil {
+			return nil, err
+		}
+		return rf.Invoke(t, []MalValue{acc})
+	})
+	m[makeSymbol("into")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		var items []MalValue
+		var err error
+		switch len(args) {
+		case 0:
+			return NewVector([]MalValue{}), nil
+		case 1:
+			return args[0], nil
+		case 2:
+			items, err = seqValues(args[1])
+		case 3:
+			var xf MalInvoke
+			if xf, err = funcArg(args[1]); err == nil {
+				items, err = transduceValues(t, xf, args[2])
+			}
+		default:
+			return nil, ErrWrongFuncNArgs
+		}
+		if err != nil {
+			return nil, err
+		}
+		return conjOf(args[0], items)
+	})
+	m[makeSymbol("sequence")] = makeFunc(func(t *Thread, args []MalValue) (MalValue, error) {
+		switch len(args) {
+		case 1:
+			seq, err := seqOf(args[0])
+			if seq == nil && err == nil {
+				return NewList([]MalValue{}), nil
+			}
+			return seq, err
+		case 2:
+			xf, err := funcArg(args[0])
+			if err != nil {
+				return nil, err
+			}
+			s, err := xfSeq(t, xf, args[1])
+			if err != nil {
+				return nil, err
+			}
+			return lazyIf(s, args[1])
+		default:
+			return nil, ErrWrongFuncNArgs
+		}
+	})
+
+	return Namespace{M: m}
+}
@@ -13,11 +13,25 @@ type MalValue interface {
 	MalValue()
 }
 
+// MalInvoke is implemented by the values that can be called. They are
+// called in the Thread of the caller.
 type MalInvoke interface {
-	Invoke([]MalValue) (MalValue, error)
+	Invoke(t *Thread, args []MalValue) (MalValue, error)
 	IsMacro() bool
 }
 
+// MalMeta is implemented by values that carry metadata.
+type MalMeta interface {
+	GetMeta() MalValue
+}
+
+// MalWithMeta is implemented by immutable values that carry metadata.
+// WithMeta returns a copy of the value with the metadata meta.
+type MalWithMeta interface {
+	MalMeta
+	WithMeta(meta MalValue) MalValue
+}
+
 type MalValueType int
 
 const (
@@ -36,6 +50,13 @@ func (MalList) MalValue() {}
 func (m MalList) IsVector() bool {
 	return m.Vector
 }
+func (m MalList) GetMeta() MalValue {
+	return m.Meta
+}
+func (m MalList) WithMeta(meta MalValue) MalValue {
+	m.Meta = meta
+	return m
+}
 func NewList(values []MalValue) MalList {
 	return MalList{Values: values}
 }
@@ -51,19 +72,36 @@ func (MalInt) MalValue() {}
 
 type MalSymbol struct {
 	Value string
+	Meta  MalValue // nil by default
 }
 
 func (MalSymbol) MalValue() {}
+func (s MalSymbol) GetMeta() MalValue {
+	return s.Meta
+}
+func (s MalSymbol) WithMeta(meta MalValue) MalValue {
+	s.Meta = meta
+	return s
+}
 
 type MalFunc struct {
-	F     func([]MalValue) (MalValue, error)
+	F     func(t *Thread, args []MalValue) (MalValue, error)
 	Macro bool
 	Meta  MalValue // nil by default
+	Name  string   // empty for anonymous functions
 }
 
 func (MalFunc) MalValue() {}
-func (f MalFunc) Invoke(args []MalValue) (MalValue, error) {
-	return f.F(args)
+func (f MalFunc) GetMeta() MalValue {
+	return f.Meta
+}
+func (f MalFunc) WithMeta(meta MalValue) MalValue {
+	f.Meta = meta
+	return f
+}
+func (f MalFunc) Invoke(t *Thread, args []MalValue) (result MalValue, err error) {
+	defer recoverError(&err)
+	return f.F(t, args)
 }
 func (f MalFunc) IsMacro() bool {
 	return f.Macro
@@ -73,12 +111,20 @@ type MalTcoFunc struct {
 	Ast    MalValue
 	Params []string
 	Env    *Env
+	Ns     *Env // environment of the module the function was defined in
 	Fn     MalFunc
 }
 
 func (MalTcoFunc) MalValue() {}
-func (f MalTcoFunc) Invoke(args []MalValue) (MalValue, error) {
-	return f.Fn.F(args)
+func (f MalTcoFunc) GetMeta() MalValue {
+	return f.Fn.Meta
+}
+func (f MalTcoFunc) WithMeta(meta MalValue) MalValue {
+	f.Fn.Meta = meta
+	return f
+}
+func (f MalTcoFunc) Invoke(t *Thread, args []MalValue) (MalValue, error) {
+	return f.Fn.Invoke(t, args)
 }
 func (f MalTcoFunc) IsMacro() bool {
 	return f.Fn.Macro
@@ -102,11 +148,15 @@ func (MalString) MalValue() {}
 func (s MalString) IsKeyword() bool {
 	return isKeywordString(s.Value)
 }
-func (s MalString) AsKeyword() string {
+
+var errNotKeyword = NewKindError(ErrKindType, "expected keyword, got string")
+
+// AsKeyword returns the name of the keyword s.
+func (s MalString) AsKeyword() (string, error) {
 	if !s.IsKeyword() {
-		panic("not a keyword")
+		return "", errNotKeyword
 	}
-	return strings.TrimPrefix(s.Value, KeywordPrefix)
+	return strings.TrimPrefix(s.Value, KeywordPrefix), nil
 }
 
 func isKeywordString(s string) bool {
@@ -121,11 +171,17 @@ func NewKeyword(s string) MalString {
 	return MalString{Value: KeywordPrefix + s}
 }
 
+// MalAtom is a mutable reference. Its metadata is changed in place by
+// alter-meta! and reset-meta!, as atoms cannot be copied by with-meta.
 type MalAtom struct {
-	Ref MalValue
+	Ref  MalValue
+	Meta MalValue // nil by default
 }
 
 func (*MalAtom) MalValue() {}
+func (a *MalAtom) GetMeta() MalValue {
+	return a.Meta
+}
 func NewMalAtom(v MalValue) *MalAtom {
 	return &MalAtom{Ref: v}
 }
@@ -186,10 +242,17 @@ func (m *MalMap) SetMeta(meta MalValue) {
 	m.meta = meta
 }
 
+func (m *MalMap) WithMeta(meta MalValue) MalValue {
+	copied := CloneMap(m)
+	copied.SetMeta(meta)
+	return copied
+}
+
+// CloneMap returns a copy of m, including its metadata.
 func CloneMap(m *MalMap) *MalMap {
 	newMap := make([]MalMapEntry, len(m.values))
 	copy(newMap, m.values)
-	return &MalMap{values: newMap}
+	return &MalMap{values: newMap, meta: m.meta}
 }
 
 func NewMapFromList(values []MalValue) (*MalMap, error) {
@@ -213,109 +276,119 @@ func NewFloat(f float64) MalFloat {
 	return MalFloat{Value: f}
 }
 
+// malEq reports whether v1 and v2 are equal, as malEqual does. Failing
+// to realize a lazy sequence makes them unequal, which is what map keys
+// need; the = builtin raises the error instead.
 func malEq(v1 MalValue, v2 MalValue) bool {
+	eq, err := malEqual(v1, v2)
+	return err == nil && eq
+}
+
+// malEqual reports whether v1 and v2 are equal, realizing lazy sequences
+// as far as needed to compare them.
+func malEqual(v1 MalValue, v2 MalValue) (bool, error) {
 	if v1 == nil {
-		return v2 == nil
+		return v2 == nil, nil
 	}
 
 	switch v1 := v1.(type) {
 	case MalInt:
 		v2, ok := v2.(MalInt)
-		if !ok {
-			return false
-		}
-		return v1.Value == v2.Value
+		return ok && v1.Value == v2.Value, nil
 	case MalFloat:
 		v2, ok := v2.(MalFloat)
-		if !ok {
-			return false
-		}
-		return v1.Value == v2.Value
+		return ok && v1.Value == v2.Value, nil
 	case MalSymbol:
 		v2, ok := v2.(MalSymbol)
-		if !ok {
-			return false
-		}
-		return v1.Value == v2.Value
-	case MalFunc:
-		_, ok := v2.(MalFunc)
-		if !ok {
-			return false
-		}
-		panic("unimplemented")
+		return ok && v1.Value == v2.Value, nil
+	case MalFunc, MalTcoFunc:
+		// functions are not comparable
+		return false, nil
+	case *MalAtom:
+		return v1 == v2, nil
+	case *MalError:
+		return v1 == v2, nil
+	case *MalReduced, *MalRegex:
+		return v1 == v2, nil
+	case MalInst:
+		v2, ok := v2.(MalInst)
+		return ok && v1.Time.Equal(v2.Time), nil
+	case MalUUID:
+		v2, ok := v2.(MalUUID)
+		return ok && v1.Value == v2.Value, nil
 	case MalBool:
 		v2, ok := v2.(MalBool)
-		if !ok {
-			return false
-		}
-		return v1.Value == v2.Value
+		return ok && v1.Value == v2.Value, nil
 	case MalString:
 		v2, ok := v2.(MalString)
-		if !ok {
-			return false
-		}
-		return v1.Value == v2.Value
+		return ok && v1.Value == v2.Value, nil
+	case *MalLazySeq:
+		return seqEq(v1, v2)
 	case MalList:
-		v2, ok := v2.(MalList)
-		if !ok {
-			return false
+		if _, ok := v2.(*MalLazySeq); ok {
+			return seqEq(v1, v2)
 		}
-		if len(v1.Values) != len(v2.Values) {
-			return false
+		v2, ok := v2.(MalList)
+		if !ok || len(v1.Values) != len(v2.Values) {
+			return false, nil
 		}
 		for i := range v1.Values {
-			if !malEq(v1.Values[i], v2.Values[i]) {
-				return false
+			if eq, err := malEqual(v1.Values[i], v2.Values[i]); !eq || err != nil {
+				return false, err
 			}
 		}
+		return true, nil
+	case *MalMap, *MalSortedMap:
+		return mapEq(v1, v2)
+	case *MalSet, *MalSortedSet:
+		return setEq(v1, v2)
+	default:
+		// values of unknown types are never equal
+		return false, nil
+	}
+}
 
-		return true
-	case *MalMap:
-		v2, ok := v2.(*MalMap)
-		if !ok {
-			return false
+// seqEq compares sequences element by element, realizing lazy ones as
+// far as needed.
+func seqEq(v1 MalValue, v2 MalValue) (bool, error) {
+	if !isSeq(v2) {
+		return false, nil
+	}
+	for {
+		first1, rest1, ok1, err := uncons(v1)
+		if err != nil {
+			return false, err
 		}
-		if len(v1.values) != len(v2.values) {
-			return false
+		first2, rest2, ok2, err := uncons(v2)
+		if err != nil {
+			return false, err
 		}
-
-		makeMap := func(m *MalMap) map[string]MalValue {
-			mm := make(map[string]MalValue)
-			for _, entry := range m.Iter() {
-				key := entry.Key
-				keyString, ok := key.(MalString)
-				if !ok {
-					panic("unimplemented")
-				}
-				mm[keyString.Value] = entry.Value
-			}
-			return mm
+		if !ok1 || !ok2 {
+			return ok1 == ok2, nil
 		}
-		v1Map := makeMap(v1)
-		v2Map := makeMap(v2)
-
-		for k1, v1 := range v1Map {
-			v2, ok := v2Map[k1]
-			if !ok {
-				return false
-			}
-			if !malEq(v1, v2) {
-				return false
-			}
+		if eq, err := malEqual(first1, first2); !eq || err != nil {
+			return false, err
 		}
+		v1, v2 = rest1, rest2
+	}
+}
 
-		return true
-	default:
-		panic("unreachable")
+func isTruthy(v MalValue) bool {
+	if v == nil {
+		return false
+	}
+	if b, ok := v.(MalBool); ok {
+		return b.Value
 	}
+	return true
 }
 
-func isMacroCall(ast MalValue, env *Env) bool {
+func isMacroCall(t *Thread, ast MalValue, replEnv *Env, env *Env) bool {
 	switch v := ast.(type) {
 	case MalList:
 		if len(v.Values) > 0 {
 			if sym, ok := v.Values[0].(MalSymbol); ok {
-				if f, ok := env.Get(sym.Value); ok {
+				if f, ok := lookupSymbol(t, sym.Value, replEnv, env); ok {
 					if f, ok := f.(MalInvoke); ok {
 						return f.IsMacro()
 					}